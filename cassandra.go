@@ -1,89 +1,282 @@
 package main
 
 import (
-	"bufio"
 	"fmt"
-	"html/template"
 	"io/ioutil"
 	"log"
 	"os"
+	"strings"
 	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	cassandraNativePort   = 9042
+	cassandraJMXPort      = 7199
+	cassandraMaxSeeds     = 3
+	cassandraStartTimeout = 5 * time.Minute
 )
 
 type cassandra struct{}
 
-func (cassandra) start(c *cluster) {
-	yamlPath, err := makeCassandraYAML(c)
+// start starts the seed nodes and then the remaining nodes, each group in
+// parallel. A node is considered started once it has joined the ring.
+func (r cassandra) start(c *cluster) {
+	cfg, err := cassandraConfig()
 	if err != nil {
 		log.Fatal(err)
 	}
-	c.put(yamlPath, "./cassandra.yaml")
-	_ = os.Remove(yamlPath)
-
-	display := fmt.Sprintf("%s: starting cassandra (be patient)", c.name)
 	nodes := c.serverNodes()
-	c.parallel(display, len(nodes), 1, func(i int) ([]byte, error) {
-		host := c.host(nodes[i])
-		user := c.user(nodes[i])
+	seeds := nodes
+	if len(seeds) > cassandraMaxSeeds {
+		seeds = seeds[:cassandraMaxSeeds]
+	}
+	seedAddrs := make([]string, len(seeds))
+	for i, node := range seeds {
+		if c.isLocal() {
+			seedAddrs[i] = cassandraLocalAddr(node)
+		} else if seedAddrs[i], err = c.getInternalIP(node); err != nil {
+			log.Fatal(err)
+		}
+	}
 
-		if err := func() error {
-			session, err := newSSHSession(user, host)
-			if err != nil {
-				return err
+	for _, node := range nodes {
+		yamlPath, err := makeCassandraYAML(c, cfg, node, strings.Join(seedAddrs, ","))
+		if err != nil {
+			log.Fatal(err)
+		}
+		t := *c
+		t.nodes = []int{node}
+		if c.isLocal() {
+			if err := t.run(ioutil.Discard, t.nodes, "mkdir", "mkdir -p "+r.dataDir(c, node)); err != nil {
+				log.Fatal(err)
 			}
-			defer session.Close()
+		}
+		t.put(yamlPath, r.configPath(c, node))
+		_ = os.Remove(yamlPath)
+	}
+
+	display := fmt.Sprintf("%s: starting cassandra seeds (be patient)", c.name)
+	c.parallel(display, len(seeds), 0, func(i int) ([]byte, error) {
+		return r.startNode(c, seeds[i], true /* seed */)
+	})
 
-			cmd := c.env + ` cassandra` +
-				` -Dcassandra.config=file://${PWD}/cassandra.yaml` +
-				` -Dcassandra.ring_delay_ms=3000` +
-				` > cassandra.stdout 2> cassandra.stderr`
-			_, err = session.CombinedOutput(cmd)
+	if others := nodes[len(seeds):]; len(others) > 0 {
+		display = fmt.Sprintf("%s: starting cassandra (be patient)", c.name)
+		c.parallel(display, len(others), 0, func(i int) ([]byte, error) {
+			return r.startNode(c, others[i], false /* seed */)
+		})
+	}
+}
+
+// startNode starts the specified node and waits for it to join the ring. If
+// the node exits or doesn't join within cassandraStartTimeout, the tail of its
+// log is returned along with an error.
+func (r cassandra) startNode(c *cluster, index int, seed bool) ([]byte, error) {
+	host := c.host(index)
+	user := c.user(index)
+	logs := r.logDir(c, index)
+
+	if err := func() error {
+		session, err := newSSHSession(user, host)
+		if err != nil {
 			return err
-		}(); err != nil {
-			return nil, err
 		}
+		defer session.Close()
 
-		for {
-			up, err := func() (bool, error) {
-				session, err := newSSHSession(user, host)
-				if err != nil {
-					return false, err
-				}
-				defer session.Close()
-
-				cmd := `nc -z $(hostname) 9042`
-				if _, err := session.CombinedOutput(cmd); err != nil {
-					return false, nil
-				}
-				return true, nil
-			}()
+		env := c.env
+		if c.isLocal() {
+			// Multiple nodes share the machine. Keep each node's logs in its own
+			// directory and limit the heap.
+			env += fmt.Sprintf(" CASSANDRA_LOG_DIR=%s/logs MAX_HEAP_SIZE=1G HEAP_NEWSIZE=256M", logs)
+		}
+		cmd := env + ` cassandra` +
+			` -p ` + logs + `/cassandra.pid` +
+			` -Dcassandra.config=file://` + r.configPath(c, index) +
+			` -Dcassandra.ring_delay_ms=3000` +
+			fmt.Sprintf(` -Dcassandra.jmx.local.port=%d`, r.jmxPort(c, index))
+		if !seed {
+			// The cluster is empty when it is started, so the non-seed nodes can
+			// safely bootstrap concurrently.
+			cmd += ` -Dcassandra.consistent.rangemovement=false`
+		}
+		cmd += ` > ` + logs + `/cassandra.stdout 2> ` + logs + `/cassandra.stderr`
+		_, err = session.CombinedOutput(cmd)
+		return err
+	}(); err != nil {
+		return nil, err
+	}
+
+	check := fmt.Sprintf(`
+if ! kill -0 $(cat %[1]s/cassandra.pid 2>/dev/null) 2>/dev/null; then
+  echo exited
+else
+  nodetool -p %[2]d status 2>/dev/null | awk -v addr=%[3]s '$1 == "UN" && $2 == addr {print "joined"}'
+fi
+`, logs, r.jmxPort(c, index), r.listenAddr(c, index))
+
+	var state string
+	deadline := time.Now().Add(cassandraStartTimeout)
+	for {
+		if time.Now().After(deadline) {
+			state = fmt.Sprintf("timed out after %s", cassandraStartTimeout)
+			break
+		}
+		out, err := func() ([]byte, error) {
+			session, err := newSSHSession(user, host)
 			if err != nil {
 				return nil, err
 			}
-			if up {
-				break
-			}
-			time.Sleep(time.Second)
+			defer session.Close()
+			return session.CombinedOutput(check)
+		}()
+		if err != nil {
+			return nil, err
+		}
+		state = strings.TrimSpace(string(out))
+		if state == "joined" {
+			return nil, nil
 		}
-		return nil, nil
+		if state == "exited" {
+			break
+		}
+		time.Sleep(time.Second)
+	}
+
+	session, err := newSSHSession(user, host)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+	out, _ := session.CombinedOutput(fmt.Sprintf("tail -n 20 %[1]s/cassandra.stdout %[1]s/cassandra.stderr", logs))
+	return out, fmt.Errorf("cassandra %s before joining the ring", state)
+}
+
+// stop drains each node so that the commitlog is flushed before the node is
+// killed.
+func (r cassandra) stop(c *cluster) {
+	display := fmt.Sprintf("%s: stopping", c.name)
+	c.stopNodes(display, func(index int) string {
+		return r.killCmd(c, index)
 	})
 }
 
-func (cassandra) nodeURL(_ *cluster, host string, port int) string {
+func (r cassandra) wipe(c *cluster) {
+	display := fmt.Sprintf("%s: wiping", c.name)
+	c.stopNodes(display, func(index int) string {
+		return r.killCmd(c, index) + "rm -fr " + r.dataDir(c, index) + " ;\n"
+	})
+}
+
+func (r cassandra) killCmd(c *cluster, index int) string {
+	jmx := r.jmxPort(c, index)
+	cmd := fmt.Sprintf(`timeout 60 nodetool -p %[1]d drain > /dev/null 2>&1 ;
+kill -9 $(lsof -t -i :%[1]d -sTCP:LISTEN) 2>/dev/null || true ;
+`, jmx)
+	if !c.isLocal() {
+		// Catch nodes which never opened the JMX port. Local clusters can't do
+		// this as it would kill the other nodes.
+		cmd += "pkill -9 -f CassandraDaemon || true ;\n"
+	}
+	return cmd
+}
+
+// status displays the state, load and token ownership of each node along with
+// the number of nodes it considers up in the ring.
+func (r cassandra) status(c *cluster) {
+	c.printStatus(func(index int) string {
+		return fmt.Sprintf(`nodetool -p %d status 2>/dev/null | awk -v addr=%s '
+/^[UD][NLJM] / { total++; if ($1 ~ /^U/) up++ }
+$2 == addr { self = "cassandra " $1 " load=" $3 $4 " owns=" $6 }
+END { if (self != "") print self, "ring=" up "/" total }'
+`, r.jmxPort(c, index), r.listenAddr(c, index))
+	})
+}
+
+// cassandraLocalAddr returns the loopback address the specified node of a
+// local cluster listens on. Cassandra requires the storage port to be the same
+// on every node, so local nodes are distinguished by address. On macOS the
+// addresses other than 127.0.0.1 need to be aliased to lo0 first:
+//
+//	sudo ifconfig lo0 alias 127.0.0.2 up
+func cassandraLocalAddr(index int) string {
+	return fmt.Sprintf("127.0.0.%d", index)
+}
+
+// listenAddr returns a shell expression for the address the specified node
+// listens on.
+func (cassandra) listenAddr(c *cluster, index int) string {
+	if c.isLocal() {
+		return cassandraLocalAddr(index)
+	}
+	return "$(hostname --all-ip-addresses | awk '{print $1}')"
+}
+
+// logDir returns the directory containing the stdout and stderr of the
+// specified node.
+func (r cassandra) logDir(c *cluster, index int) string {
+	if c.isLocal() {
+		return r.dataDir(c, index)
+	}
+	return "."
+}
+
+// dataDir returns the directory containing the data for the specified node.
+func (cassandra) dataDir(c *cluster, index int) string {
+	if c.isLocal() {
+		return fmt.Sprintf("${HOME}/local/cassandra%d", index)
+	}
+	return "/mnt/data1/cassandra"
+}
+
+// configPath returns the path of the cassandra.yaml for the specified node.
+func (r cassandra) configPath(c *cluster, index int) string {
+	if c.isLocal() {
+		return r.dataDir(c, index) + "/cassandra.yaml"
+	}
+	return "${PWD}/cassandra.yaml"
+}
+
+func (cassandra) jmxPort(c *cluster, index int) int {
+	port := cassandraJMXPort
+	if c.isLocal() {
+		port += index - 1
+	}
+	return port
+}
+
+func (cassandra) nodeURL(c *cluster, host string, port int) string {
+	if c.isLocal() {
+		// Local nodes each listen on their own address.
+		host = cassandraLocalAddr(port - cassandraNativePort + 1)
+	}
 	return fmt.Sprintf("'cassandra://%s:%d'", host, port)
 }
 
 func (cassandra) nodePort(c *cluster, index int) int {
+	port := cassandraNativePort
 	if c.isLocal() {
-		// TODO(peter): This will require a bit of work to adjust ports in
-		// cassandra.yaml.
-		panic("unimplemented: local cassandra cluster")
+		port += index - 1
 	}
-	return 9042
+	return port
+}
+
+func (cassandra) loadNodes(c *cluster) []int {
+	return c.serverNodes()
+}
+
+func (cassandra) restartCmd(c *cluster, index int) (string, error) {
+	return "", fmt.Errorf("restarting cassandra nodes is not supported")
 }
 
-func makeCassandraYAML(c *cluster) (string, error) {
-	ip, err := c.getInternalIP(c.serverNodes()[0])
+func makeCassandraYAML(c *cluster, cfg yaml.MapSlice, index int, seeds string) (string, error) {
+	var listen string
+	if c.isLocal() {
+		listen = cassandraLocalAddr(index)
+	}
+
+	data, err := yaml.Marshal(cassandraNodeConfig(c, cfg, index, seeds, listen))
 	if err != nil {
 		return "", err
 	}
@@ -94,19 +287,8 @@ func makeCassandraYAML(c *cluster) (string, error) {
 	}
 	defer f.Close()
 
-	w := bufio.NewWriter(f)
-	w.WriteString(cassandraDefaultYAML)
-	defer w.Flush()
-
-	t, err := template.New("cassandra.yaml").Parse(cassandraDiffYAML)
-	if err != nil {
-		log.Fatal(err)
-	}
-	m := map[string]interface{}{
-		"Seeds": ip,
-	}
-	if err := t.Execute(w, m); err != nil {
-		log.Fatal(err)
+	if _, err := f.Write(data); err != nil {
+		return "", err
 	}
 	return f.Name(), nil
 }
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+var cassandraConfigFile string
+var cassandraSettings []string
+
+// cassandraRecordedConfig is the effective config recorded in the metadata of
+// a test being resumed. If set it is used verbatim instead of constructing the
+// config from the defaults and overrides.
+var cassandraRecordedConfig string
+
+// cassandraConfig returns the cluster-wide cassandra config. The config is
+// constructed by merging, in order, cassandraDiffYAML, the file specified by
+// --cassandra-config and the --cassandra-set settings into
+// cassandraDefaultYAML.
+func cassandraConfig() (yaml.MapSlice, error) {
+	if cassandraRecordedConfig != "" {
+		var cfg yaml.MapSlice
+		if err := yaml.Unmarshal([]byte(cassandraRecordedConfig), &cfg); err != nil {
+			return nil, errors.Wrap(err, "recorded cassandra config")
+		}
+		return cfg, nil
+	}
+
+	var cfg yaml.MapSlice
+	if err := yaml.Unmarshal([]byte(cassandraDefaultYAML), &cfg); err != nil {
+		return nil, errors.Wrap(err, "default cassandra config")
+	}
+	var diff yaml.MapSlice
+	if err := yaml.Unmarshal([]byte(cassandraDiffYAML), &diff); err != nil {
+		return nil, errors.Wrap(err, "cassandra config overrides")
+	}
+	cfg = mergeYAML(cfg, diff)
+
+	if cassandraConfigFile != "" {
+		data, err := ioutil.ReadFile(cassandraConfigFile)
+		if err != nil {
+			return nil, err
+		}
+		var file yaml.MapSlice
+		if err := yaml.Unmarshal(data, &file); err != nil {
+			return nil, errors.Wrapf(err, "could not parse %s", cassandraConfigFile)
+		}
+		cfg = mergeYAML(cfg, file)
+	}
+
+	for _, s := range cassandraSettings {
+		setting, err := parseCassandraSetting(s)
+		if err != nil {
+			return nil, err
+		}
+		cfg = mergeYAML(cfg, setting)
+	}
+	return cfg, nil
+}
+
+// parseCassandraSetting parses a <key>=<value> setting into a config that can
+// be merged. Nested settings are specified using dotted keys (e.g.
+// client_encryption_options.enabled=true). The value is parsed as YAML and an
+// empty value removes the setting.
+func parseCassandraSetting(s string) (yaml.MapSlice, error) {
+	i := strings.Index(s, "=")
+	if i <= 0 {
+		return nil, fmt.Errorf("invalid cassandra setting, expected <key>=<value>: %q", s)
+	}
+	var value interface{}
+	if err := yaml.Unmarshal([]byte(s[i+1:]), &value); err != nil {
+		return nil, errors.Wrapf(err, "invalid cassandra setting: %q", s)
+	}
+	keys := strings.Split(s[:i], ".")
+	for j := len(keys) - 1; j > 0; j-- {
+		value = yaml.MapSlice{{Key: keys[j], Value: value}}
+	}
+	return yaml.MapSlice{{Key: keys[0], Value: value}}, nil
+}
+
+// mergeYAML merges src into dst, returning the result. Nested maps are merged
+// recursively, all other values in src replace the corresponding value in dst
+// and a null value in src removes the setting from dst. The order of the
+// settings in dst is preserved and new settings are appended.
+func mergeYAML(dst, src yaml.MapSlice) yaml.MapSlice {
+	r := make(yaml.MapSlice, len(dst))
+	copy(r, dst)
+
+	for _, item := range src {
+		i := 0
+		for ; i < len(r); i++ {
+			if r[i].Key == item.Key {
+				break
+			}
+		}
+
+		switch {
+		case item.Value == nil:
+			if i < len(r) {
+				r = append(r[:i], r[i+1:]...)
+			}
+		case i == len(r):
+			r = append(r, item)
+		default:
+			d, ok1 := r[i].Value.(yaml.MapSlice)
+			s, ok2 := item.Value.(yaml.MapSlice)
+			if ok1 && ok2 {
+				r[i].Value = mergeYAML(d, s)
+			} else {
+				r[i].Value = item.Value
+			}
+		}
+	}
+	return r
+}
+
+// cassandraNodeConfig returns the config for the specified node: cfg with the
+// directories, ports, addresses and seeds for the node set.
+func cassandraNodeConfig(c *cluster, cfg yaml.MapSlice, index int, seeds, listen string) yaml.MapSlice {
+	dir := os.ExpandEnv(cassandra{}.dataDir(c, index))
+	node := yaml.MapSlice{
+		{Key: "commitlog_directory", Value: dir + "/commitlog"},
+		{Key: "data_file_directories", Value: []string{dir + "/data"}},
+		{Key: "hints_directory", Value: dir + "/hints"},
+		{Key: "saved_caches_directory", Value: dir + "/saved_caches"},
+		{Key: "native_transport_port", Value: cassandra{}.nodePort(c, index)},
+		{Key: "seed_provider", Value: []yaml.MapSlice{{
+			{Key: "class_name", Value: "org.apache.cassandra.locator.SimpleSeedProvider"},
+			{Key: "parameters", Value: []yaml.MapSlice{{
+				{Key: "seeds", Value: seeds},
+			}}},
+		}}},
+	}
+	if listen != "" {
+		node = append(node,
+			yaml.MapItem{Key: "listen_address", Value: listen},
+			yaml.MapItem{Key: "rpc_address", Value: listen})
+	}
+	return mergeYAML(cfg, node)
+}
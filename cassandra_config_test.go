@@ -0,0 +1,103 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func parseTestYAML(t *testing.T, s string) yaml.MapSlice {
+	var m yaml.MapSlice
+	if err := yaml.Unmarshal([]byte(s), &m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestMergeYAML(t *testing.T) {
+	testCases := []struct {
+		dst, src, expected string
+	}{
+		// New settings are appended and existing settings keep their order.
+		{"a: 1\nb: 2", "c: 3\na: 4", "a: 4\nb: 2\nc: 3\n"},
+		// A null value removes the setting.
+		{"a: 1\nb: 2\nc: 3", "b: null", "a: 1\nc: 3\n"},
+		{"a: 1", "b: null", "a: 1\n"},
+		// Nested maps are merged recursively.
+		{"a:\n  x: 1\n  q: 2\nb: 3", "a:\n  q: 4\n  z: 5", "a:\n  x: 1\n  q: 4\n  z: 5\nb: 3\n"},
+		{"a:\n  x: 1\n  q: 2", "a:\n  x: null", "a:\n  q: 2\n"},
+		// Other values replace the setting, including lists and maps replacing
+		// scalars.
+		{"a:\n- 1\n- 2", "a:\n- 3", "a:\n- 3\n"},
+		{"a: 1", "a:\n  x: 2", "a:\n  x: 2\n"},
+		{"a:\n  x: 1", "a: 2", "a: 2\n"},
+	}
+	for _, c := range testCases {
+		dst := parseTestYAML(t, c.dst)
+		r := mergeYAML(dst, parseTestYAML(t, c.src))
+		out, err := yaml.Marshal(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != c.expected {
+			t.Errorf("merge %q into %q: expected %q, got %q", c.src, c.dst, c.expected, out)
+		}
+		// The destination is not modified.
+		if !reflect.DeepEqual(dst, parseTestYAML(t, c.dst)) {
+			t.Errorf("merge %q into %q: destination modified: %v", c.src, c.dst, dst)
+		}
+	}
+}
+
+func TestParseCassandraSetting(t *testing.T) {
+	testCases := []struct {
+		setting  string
+		expected yaml.MapSlice
+	}{
+		{"concurrent_writes=64", yaml.MapSlice{{Key: "concurrent_writes", Value: 64}}},
+		{"commitlog_sync=batch", yaml.MapSlice{{Key: "commitlog_sync", Value: "batch"}}},
+		{"a=x=y", yaml.MapSlice{{Key: "a", Value: "x=y"}}},
+		{"a=[1, 2]", yaml.MapSlice{{Key: "a", Value: []interface{}{1, 2}}}},
+		// An empty value removes the setting.
+		{"commitlog_sync_period_in_ms=", yaml.MapSlice{{Key: "commitlog_sync_period_in_ms", Value: nil}}},
+		{"a=null", yaml.MapSlice{{Key: "a", Value: nil}}},
+		// Dotted keys specify nested settings.
+		{"client_encryption_options.enabled=true", yaml.MapSlice{{
+			Key: "client_encryption_options", Value: yaml.MapSlice{{Key: "enabled", Value: true}},
+		}}},
+		{"a.b.c=1", yaml.MapSlice{{
+			Key: "a", Value: yaml.MapSlice{{Key: "b", Value: yaml.MapSlice{{Key: "c", Value: 1}}}},
+		}}},
+	}
+	for _, c := range testCases {
+		m, err := parseCassandraSetting(c.setting)
+		if err != nil {
+			t.Errorf("%s: %s", c.setting, err)
+			continue
+		}
+		if !reflect.DeepEqual(m, c.expected) {
+			t.Errorf("%s: expected %v, got %v", c.setting, c.expected, m)
+		}
+	}
+
+	for _, s := range []string{"", "a", "=1", "a=[1"} {
+		if _, err := parseCassandraSetting(s); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+
+	// A nested setting is merged into the existing nested settings.
+	cfg := parseTestYAML(t, "client_encryption_options:\n  enabled: false\n  keystore: conf/.keystore\n")
+	setting, err := parseCassandraSetting("client_encryption_options.enabled=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := yaml.Marshal(mergeYAML(cfg, setting))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := "client_encryption_options:\n  enabled: true\n  keystore: conf/.keystore\n"; string(out) != e {
+		t.Errorf("expected %q, got %q", e, out)
+	}
+}
@@ -1,29 +1,18 @@
 package main
 
+// cassandraDiffYAML contains the overrides of cassandraDefaultYAML used for
+// all cassandra clusters. It is merged into the default config before any
+// user-specified overrides. A null value removes a setting. The per-node
+// settings (directories, ports, addresses and seeds) are set by
+// cassandraNodeConfig.
 const cassandraDiffYAML = `
 commitlog_sync: batch
 commitlog_sync_batch_window_in_ms: 2
-commitlog_sync_period_in_ms: 0
+commitlog_sync_period_in_ms: null
 
 read_request_timeout_in_ms: 10000
 write_request_timeout_in_ms: 10000
 
-commitlog_directory: /mnt/data1/cassandra/commitlog
-data_file_directories:
-    - /mnt/data1/cassandra/data
-hints_directory: /mnt/data1/cassandra/hints
-saved_caches_directory: /mnt/data1/cassandra/saved_caches
-
-seed_provider:
-    # Addresses of hosts that are deemed contact points.
-    # Cassandra nodes use this list of hosts to find each other and learn
-    # the topology of the ring.  You must change this if you are running
-    # multiple nodes!
-    - class_name: org.apache.cassandra.locator.SimpleSeedProvider
-      parameters:
-          # seeds is actually a comma-delimited list of addresses.
-          # Ex: "<ip1>,<ip2>,<ip3>"
-          - seeds: "{{.Seeds}}"
 `
 
 // Note: this is the default cassandra.yaml that ships with Cassandra
@@ -0,0 +1,489 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// chaosSpecs are the faults injected during the load of each run (see --chaos).
+var chaosSpecs []string
+
+// chaosRule tags the iptables rules added by partitions so that they can be
+// removed without disturbing other rules.
+const chaosRule = "roachperf-chaos"
+
+// chaosEvent is a fault injected at a time relative to the start of the load.
+// The fault is reverted after its duration, or at the end of the load if it
+// has no duration. A killed node is restarted after its duration, and remains
+// down until the next run if it has none.
+type chaosEvent struct {
+	At       time.Duration
+	Kind     string
+	Nodes    []int
+	Peers    []int
+	Duration time.Duration
+	// Netem are the tc netem parameters (e.g. "delay 100ms loss 1%").
+	Netem string
+
+	// peerIPs are the addresses of the partition peers whose traffic is
+	// dropped, resolved when the partition is injected.
+	peerIPs []string
+}
+
+// chaosOptions are the options accepted by each kind of fault.
+var chaosOptions = map[string][]string{
+	"kill":      {"node", "restart"},
+	"partition": {"a", "b", "for"},
+	"netem":     {"node", "delay", "jitter", "loss", "for"},
+	"stall":     {"node", "for"},
+}
+
+// parseChaos parses a fault spec of the form <at> <kind> [<option>=<value>...],
+// where <at> is the time after the start of the load at which the fault is
+// injected. The kinds of faults are:
+//
+//	kill node=<nodes> [restart=<duration>]
+//	partition a=<nodes> [b=<nodes>] [for=<duration>]
+//	netem node=<nodes> [delay=<duration>] [jitter=<duration>] [loss=<percent>] [for=<duration>]
+//	stall node=<nodes> [for=<duration>]
+//
+// Killed nodes can only be restarted by cluster types which support restarting
+// individual nodes (see clusterImpl.restartCmd). A partition drops
+// the traffic between the nodes in a and the nodes in b, which defaults to the
+// other nodes of the cluster. Nodes are specified as for the cluster (e.g.
+// 1-3,5).
+func parseChaos(s string) (*chaosEvent, error) {
+	fields := strings.Fields(s)
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("invalid chaos %q: expected <at> <kind> [<option>=<value>...]", s)
+	}
+	at, err := time.ParseDuration(fields[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid chaos %q: %s", s, err)
+	}
+	e := &chaosEvent{At: at, Kind: fields[1]}
+	allowed, ok := chaosOptions[e.Kind]
+	if !ok {
+		return nil, fmt.Errorf("invalid chaos %q: unknown fault: %s", s, e.Kind)
+	}
+
+	opts := map[string]string{}
+	for _, f := range fields[2:] {
+		i := strings.Index(f, "=")
+		if i == -1 {
+			return nil, fmt.Errorf("invalid chaos %q: expected <option>=<value>, got %q", s, f)
+		}
+		k, v := f[:i], f[i+1:]
+		valid := false
+		for _, a := range allowed {
+			valid = valid || a == k
+		}
+		if !valid {
+			return nil, fmt.Errorf("invalid chaos %q: unknown %s option: %s", s, e.Kind, k)
+		}
+		opts[k] = v
+	}
+
+	nodes := func(k string) ([]int, error) {
+		v, ok := opts[k]
+		if !ok {
+			return nil, nil
+		}
+		r, err := listNodes(v, 0)
+		if err != nil || len(r) == 0 {
+			return nil, fmt.Errorf("invalid chaos %q: invalid nodes: %s", s, v)
+		}
+		return r, nil
+	}
+	duration := func(k string) (time.Duration, error) {
+		v, ok := opts[k]
+		if !ok {
+			return 0, nil
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return 0, fmt.Errorf("invalid chaos %q: %s", s, err)
+		}
+		return d, nil
+	}
+
+	if e.Kind == "partition" {
+		if e.Nodes, err = nodes("a"); err != nil {
+			return nil, err
+		}
+		if e.Peers, err = nodes("b"); err != nil {
+			return nil, err
+		}
+		if e.Nodes == nil {
+			return nil, fmt.Errorf("invalid chaos %q: no nodes specified (a=<nodes>)", s)
+		}
+	} else {
+		if e.Nodes, err = nodes("node"); err != nil {
+			return nil, err
+		}
+		if e.Nodes == nil {
+			return nil, fmt.Errorf("invalid chaos %q: no nodes specified (node=<nodes>)", s)
+		}
+	}
+	if e.Kind == "kill" {
+		e.Duration, err = duration("restart")
+	} else {
+		e.Duration, err = duration("for")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if e.Kind == "netem" {
+		var params []string
+		if d, err := duration("delay"); err != nil {
+			return nil, err
+		} else if d > 0 {
+			params = append(params, "delay", d.String())
+			if j, err := duration("jitter"); err != nil {
+				return nil, err
+			} else if j > 0 {
+				params = append(params, j.String())
+			}
+		}
+		if v, ok := opts["loss"]; ok {
+			if _, err := strconv.ParseFloat(strings.TrimSuffix(v, "%"), 64); err != nil {
+				return nil, fmt.Errorf("invalid chaos %q: invalid loss: %s", s, v)
+			}
+			params = append(params, "loss", strings.TrimSuffix(v, "%")+"%")
+		}
+		if len(params) == 0 {
+			return nil, fmt.Errorf("invalid chaos %q: no delay or loss specified", s)
+		}
+		e.Netem = strings.Join(params, " ")
+	}
+	return e, nil
+}
+
+func parseChaosSpecs(specs []string) ([]*chaosEvent, error) {
+	var events []*chaosEvent
+	for _, s := range specs {
+		e, err := parseChaos(s)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+func (e *chaosEvent) String() string {
+	switch e.Kind {
+	case "partition":
+		return fmt.Sprintf("nodes %s from %s", formatNodes(e.Nodes), formatNodes(e.Peers))
+	case "netem":
+		return fmt.Sprintf("nodes %s: %s", formatNodes(e.Nodes), e.Netem)
+	default:
+		return "nodes " + formatNodes(e.Nodes)
+	}
+}
+
+func formatNodes(nodes []int) string {
+	s := make([]string, len(nodes))
+	for i, n := range nodes {
+		s[i] = strconv.Itoa(n)
+	}
+	return strings.Join(s, ",")
+}
+
+// validate checks that the fault can be injected into the cluster and resolves
+// the default partition peers.
+func (e *chaosEvent) validate(c *cluster) error {
+	servers := map[int]bool{}
+	for _, n := range c.serverNodes() {
+		servers[n] = true
+	}
+	for _, n := range append(e.Nodes, e.Peers...) {
+		if !servers[n] {
+			return fmt.Errorf("chaos %s: node %d is not a server node of %s", e.Kind, n, c.name)
+		}
+	}
+	if e.Kind == "partition" && e.Peers == nil {
+		in := map[int]bool{}
+		for _, n := range e.Nodes {
+			in[n] = true
+		}
+		for _, n := range c.serverNodes() {
+			if !in[n] {
+				e.Peers = append(e.Peers, n)
+			}
+		}
+		if e.Peers == nil {
+			return fmt.Errorf("chaos partition: no nodes to partition %s from", formatNodes(e.Nodes))
+		}
+	}
+	if e.Kind != "kill" && c.isLocal() {
+		return fmt.Errorf("chaos %s: not supported on a local cluster", e.Kind)
+	}
+	// Killed nodes are restarted after their duration or, when the cluster is
+	// reused, by the next run.
+	if e.Kind == "kill" && (e.Duration > 0 || reuseMode == reuseCluster) {
+		for _, n := range e.Nodes {
+			if _, err := c.impl.restartCmd(c, n); err != nil {
+				return fmt.Errorf("chaos kill: %s", err)
+			}
+		}
+	}
+	return nil
+}
+
+// runNode runs a command on a node, returning its output in the error if it
+// fails.
+func (c *cluster) runNode(index int, cmd string) error {
+	session, err := newSSHSession(c.user(index), c.host(index))
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	if out, err := session.CombinedOutput(cmd); err != nil {
+		return fmt.Errorf("node %d: %s: %s", index, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// runNodes runs the command returned by fn on each of the nodes in parallel.
+func (c *cluster) runNodes(nodes []int, fn func(index int) (string, error)) error {
+	errs := make([]error, len(nodes))
+	var wg sync.WaitGroup
+	for i, n := range nodes {
+		wg.Add(1)
+		go func(i, n int) {
+			defer wg.Done()
+			cmd, err := fn(n)
+			if err == nil {
+				err = c.runNode(n, cmd)
+			}
+			errs[i] = err
+		}(i, n)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const netemDevCmd = `dev=$(ip route show default | awk '{print $5; exit}'); `
+
+// inject injects the fault.
+func (e *chaosEvent) inject(c *cluster) error {
+	switch e.Kind {
+	case "kill":
+		return c.runNodes(e.Nodes, func(n int) (string, error) {
+			return fmt.Sprintf("kill -9 $(lsof -t -iTCP:%d -sTCP:LISTEN) 2>/dev/null || true",
+				c.impl.nodePort(c, n)), nil
+		})
+	case "partition":
+		e.peerIPs = nil
+		for _, n := range e.Peers {
+			ip, err := c.getInternalIP(n)
+			if err != nil {
+				return err
+			}
+			e.peerIPs = append(e.peerIPs, strings.Fields(ip + " ")[0])
+		}
+		return c.runNodes(e.Nodes, func(n int) (string, error) {
+			return e.partitionCmd("-A", " && "), nil
+		})
+	case "netem":
+		return c.runNodes(e.Nodes, func(n int) (string, error) {
+			return netemDevCmd + "sudo tc qdisc replace dev $dev root netem " + e.Netem, nil
+		})
+	case "stall":
+		return c.runNodes(e.Nodes, func(n int) (string, error) {
+			return "sudo fsfreeze --freeze " + stallMount(c, n), nil
+		})
+	}
+	return fmt.Errorf("unknown fault: %s", e.Kind)
+}
+
+// partitionCmd returns the iptables commands appending (-A) or deleting (-D)
+// the rules dropping the traffic of the partition peers, joined by sep. Each
+// partition deletes only the rules it appended, so that overlapping partitions
+// are healed independently.
+func (e *chaosEvent) partitionCmd(op, sep string) string {
+	var cmds []string
+	for _, ip := range e.peerIPs {
+		for _, rule := range []string{"INPUT -s", "OUTPUT -d"} {
+			cmds = append(cmds, fmt.Sprintf(
+				"sudo iptables %s %s %s -j DROP -m comment --comment %s",
+				op, rule, ip, chaosRule))
+		}
+	}
+	return strings.Join(cmds, sep)
+}
+
+// stallMount returns a shell expression for the mount point of the filesystem
+// holding the data of a node, which is frozen by a disk stall.
+func stallMount(c *cluster, index int) string {
+	return fmt.Sprintf("$(df --output=target %s | tail -1)", c.impl.dataDir(c, index))
+}
+
+// revert reverts the fault, restarting killed nodes.
+func (e *chaosEvent) revert(c *cluster) error {
+	switch e.Kind {
+	case "kill":
+		return c.runNodes(e.Nodes, func(n int) (string, error) {
+			return c.impl.restartCmd(c, n)
+		})
+	case "partition":
+		// A rule which was never appended, as the partition was only partially
+		// injected, fails to be deleted.
+		return c.runNodes(e.Nodes, func(n int) (string, error) {
+			return "{ " + e.partitionCmd("-D", " 2>/dev/null ; ") + " 2>/dev/null ; true ; }", nil
+		})
+	case "netem":
+		return c.runNodes(e.Nodes, func(n int) (string, error) {
+			return netemDevCmd + "sudo tc qdisc del dev $dev root 2>/dev/null || true", nil
+		})
+	case "stall":
+		return c.runNodes(e.Nodes, func(n int) (string, error) {
+			return "sudo fsfreeze --unfreeze " + stallMount(c, n) + " 2>/dev/null || true", nil
+		})
+	}
+	return fmt.Errorf("unknown fault: %s", e.Kind)
+}
+
+// restartKilled restarts the nodes killed without a restart during the
+// previous run, which remain down when the cluster is reused by the next run.
+// Nodes which are running are left alone.
+func restartKilled(c *cluster, events *eventLog) error {
+	faults, err := parseChaosSpecs(chaosSpecs)
+	if err != nil {
+		return err
+	}
+	seen := map[int]bool{}
+	var nodes []int
+	for _, e := range faults {
+		if e.Kind != "kill" || e.Duration > 0 {
+			continue
+		}
+		for _, n := range e.Nodes {
+			if !seen[n] {
+				seen[n] = true
+				nodes = append(nodes, n)
+			}
+		}
+	}
+	if len(nodes) == 0 {
+		return nil
+	}
+	events.record("restart", "nodes %s", formatNodes(nodes))
+	return c.runNodes(nodes, func(n int) (string, error) {
+		cmd, err := c.impl.restartCmd(c, n)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("lsof -i :%d -sTCP:LISTEN > /dev/null || { %s ; }",
+			c.impl.nodePort(c, n), cmd), nil
+	})
+}
+
+// revertName returns the name of the event recorded when the fault is
+// reverted.
+func (e *chaosEvent) revertName() string {
+	switch e.Kind {
+	case "kill":
+		return "restart"
+	case "partition":
+		return "heal"
+	default:
+		return e.Kind + "-end"
+	}
+}
+
+// startChaos schedules the faults relative to now, recording each fault in the
+// event log of the run when it is injected and reverted. The returned function
+// cancels the pending faults and reverts the active ones, other than killed
+// nodes without a restart, which are restarted by the next run.
+func startChaos(c *cluster, events *eventLog, faults []*chaosEvent, w io.Writer) (stop func()) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	active := map[*chaosEvent]bool{}
+
+	revert := func(e *chaosEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !active[e] {
+			return
+		}
+		delete(active, e)
+		events.record(e.revertName(), "%s", e)
+		if err := e.revert(c); err != nil {
+			fmt.Fprintf(w, "chaos %s: %s\n", e.revertName(), err)
+			events.record("chaos-error", "%s: %s", e.revertName(), err)
+		}
+	}
+
+	for _, e := range faults {
+		wg.Add(1)
+		go func(e *chaosEvent) {
+			defer wg.Done()
+			select {
+			case <-time.After(e.At):
+			case <-done:
+				return
+			}
+			mu.Lock()
+			events.record(e.Kind, "%s", e)
+			fmt.Fprintf(w, "chaos %s: %s\n", e.Kind, e)
+			err := e.inject(c)
+			if err != nil {
+				fmt.Fprintf(w, "chaos %s: %s\n", e.Kind, err)
+				events.record("chaos-error", "%s: %s", e.Kind, err)
+			}
+			// A fault which failed to be injected may have been partially
+			// injected, so it is reverted regardless.
+			active[e] = e.Kind != "kill" || err == nil
+			mu.Unlock()
+
+			if e.Duration == 0 {
+				return
+			}
+			select {
+			case <-time.After(e.Duration):
+				revert(e)
+			case <-done:
+			}
+		}(e)
+	}
+
+	return func() {
+		close(done)
+		wg.Wait()
+		for _, e := range faults {
+			if e.Kind == "kill" && e.Duration == 0 {
+				continue
+			}
+			revert(e)
+		}
+	}
+}
+
+// runChaosLoad runs the load while injecting the faults specified by --chaos.
+func runChaosLoad(c *cluster, events *eventLog, cmd string, stdout, stderr io.Writer) error {
+	faults, err := parseChaosSpecs(chaosSpecs)
+	if err != nil {
+		return err
+	}
+	for _, e := range faults {
+		if err := e.validate(c); err != nil {
+			return err
+		}
+	}
+	stop := startChaos(c, events, faults, stderr)
+	defer stop()
+	return c.runLoad(cmd, stdout, stderr)
+}
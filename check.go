@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+var checkBaseline string
+var checkMaxThroughputDrop = 5.0
+var checkMaxLatencyIncrease = 10.0
+var checkSigma = 3.0
+
+// check compares the results of a test against a baseline and returns an error
+// if any metric regressed, if nothing could be compared or if the test lacks
+// runs of the latest baseline. The baseline is either a single test directory
+// or a history directory containing test directories ("s3" for the tests
+// uploaded to S3), in which case every earlier run of the same test is used.
+func check(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected a single test directory")
+	}
+	if checkBaseline == "" {
+		return fmt.Errorf("no baseline specified")
+	}
+
+	d, err := loadTestData(args[0])
+	if err != nil {
+		return err
+	}
+	dir := checkBaseline
+	if dir == "s3" {
+		if dir, err = downloadS3(); err != nil {
+			return err
+		}
+	}
+	baselines, err := loadBaselines(dir, args[0], d)
+	if err != nil {
+		return err
+	}
+	if len(baselines) == 0 {
+		return fmt.Errorf("no baseline found for %s in %s", d.Metadata.Test, checkBaseline)
+	}
+
+	fmt.Printf("%s: %d baseline(s)\n", d.Metadata.Test, len(baselines))
+	fmt.Println("_____N___metric___baseline______sd_________new_____delta")
+	var compared, regressions int
+	for _, r := range d.Runs {
+		for _, m := range metrics {
+			var base []float64
+			for _, b := range baselines {
+				if o := b.find(r.key()); o != nil {
+					base = append(base, m.samples(o)...)
+				}
+			}
+			if len(base) == 0 {
+				continue
+			}
+			compared++
+			s := computeStats(base)
+			v := computeStats(m.samples(r)).Mean
+			delta := 100 * (v - s.Mean) / s.Mean
+
+			status := "ok"
+			if isRegression(m, s, v, delta) {
+				status = "REGRESSION"
+				regressions++
+			}
+			fmt.Printf("%6s %8s %10.1f %7s %11.1f %8.2f%%  %s\n",
+				r.key(), m.name, s.Mean, formatStat(s.Stddev), v, delta, status)
+		}
+	}
+
+	// Runs of the latest baseline which are missing from the test, such as
+	// when it was truncated, fail the check. Runs which only earlier baselines
+	// have are ignored, as they may have been removed from the test since.
+	latest := baselines[0]
+	for _, b := range baselines[1:] {
+		if b.Metadata.Date > latest.Metadata.Date {
+			latest = b
+		}
+	}
+	var missing int
+	for _, r := range latest.Runs {
+		if d.find(r.key()) == nil {
+			fmt.Printf("%6s missing (present in %s)\n", r.key(), latest.Metadata.Date)
+			missing++
+		}
+	}
+
+	switch {
+	case compared == 0:
+		return fmt.Errorf("no runs of %s to compare against the baseline", args[0])
+	case regressions > 0 || missing > 0:
+		return fmt.Errorf("%d regression(s), %d missing run(s)", regressions, missing)
+	}
+	return nil
+}
+
+// isRegression returns true if the value v of a metric is worse than the
+// baseline by more than the allowed threshold. If the baseline contains
+// multiple values, v must also be more than checkSigma standard deviations
+// from the baseline mean so that noisy metrics don't fail spuriously.
+func isRegression(m metric, base sampleStats, v, delta float64) bool {
+	worse := delta
+	threshold := checkMaxLatencyIncrease
+	if m.higherIsBetter {
+		worse = -delta
+		threshold = checkMaxThroughputDrop
+	}
+	if worse <= threshold {
+		return false
+	}
+	if math.IsNaN(base.Stddev) {
+		return true
+	}
+	return math.Abs(v-base.Mean) > checkSigma*base.Stddev
+}
+
+// loadBaselines loads the baseline test data for d from dir.
+func loadBaselines(dir, testDir string, d *testData) ([]*testData, error) {
+	if _, err := os.Stat(filepath.Join(dir, "metadata")); err == nil {
+		b, err := loadTestData(dir)
+		if err != nil {
+			return nil, err
+		}
+		return []*testData{b}, nil
+	}
+
+	ents, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	self, _ := filepath.Abs(testDir)
+	var baselines []*testData
+	for _, e := range ents {
+		if !e.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		if abs, _ := filepath.Abs(path); abs == self {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(path, "metadata")); err != nil {
+			continue
+		}
+		b, err := loadTestData(path)
+		if err != nil {
+			return nil, err
+		}
+		if b.Metadata.Test != d.Metadata.Test || b.Metadata.Date >= d.Metadata.Date {
+			continue
+		}
+		baselines = append(baselines, b)
+	}
+	return baselines, nil
+}
@@ -16,8 +16,18 @@ import (
 
 type clusterImpl interface {
 	start(c *cluster)
+	stop(c *cluster)
+	wipe(c *cluster)
+	status(c *cluster)
 	nodeURL(c *cluster, host string, port int) string
 	nodePort(c *cluster, index int) int
+	// dataDir returns the directory containing the data of a node.
+	dataDir(c *cluster, index int) string
+	// restartCmd returns the command restarting a node which was killed, or an
+	// error if restarting individual nodes is not supported.
+	restartCmd(c *cluster, index int) (string, error)
+	// loadNodes returns the server nodes which the load is directed at.
+	loadNodes(c *cluster) []int
 }
 
 type cluster struct {
@@ -32,6 +42,7 @@ type cluster struct {
 	secure  bool
 	env     string
 	args    []string
+	haproxy bool
 	impl    clusterImpl
 }
 
@@ -84,54 +95,77 @@ func (c *cluster) getInternalIP(index int) (string, error) {
 	return strings.TrimSpace(string(out)), nil
 }
 
+// portFlags returns lsof flags selecting the ports used by any of the
+// supported cluster types on the specified node.
+func (c *cluster) portFlags(index int) string {
+	return fmt.Sprintf("-i :%d -i :%d -i :%d -i :%d",
+		cockroach{}.nodePort(c, index),
+		cassandra{}.nodePort(c, index),
+		postgres{}.nodePort(c, index),
+		mongodb{}.nodePort(c, index))
+}
+
 func (c *cluster) start() {
 	c.impl.start(c)
 }
 
 func (c *cluster) stop() {
-	display := fmt.Sprintf("%s: stopping", c.name)
-	c.parallel(display, len(c.nodes), 0, func(i int) ([]byte, error) {
-		session, err := newSSHSession(c.user(c.nodes[i]), c.host(c.nodes[i]))
-		if err != nil {
-			return nil, err
-		}
-		defer session.Close()
-
-		cmd := `pkill -9 "cockroach|java|mongo|kv|ycsb" || true ;
-`
-		cmd += fmt.Sprintf("kill -9 $(lsof -t -i :%d -i :%d) 2>/dev/null || true ;\n",
-			cockroach{}.nodePort(c, c.nodes[i]),
-			cassandra{}.nodePort(c, c.nodes[i]))
-		return session.CombinedOutput(cmd)
-	})
+	c.impl.stop(c)
 }
 
 func (c *cluster) wipe() {
-	display := fmt.Sprintf("%s: wiping", c.name)
-	c.parallel(display, len(c.nodes), 0, func(i int) ([]byte, error) {
-		session, err := newSSHSession(c.user(c.nodes[i]), c.host(c.nodes[i]))
-		if err != nil {
-			return nil, err
-		}
-		defer session.Close()
+	c.impl.wipe(c)
+}
 
-		cmd := `pkill -9 "cockroach|java|mongo|kv|ycsb" || true ;
+// wipeAll wipes the cluster and then kills the processes and removes the data
+// of every supported cluster type, for clusters previously used with a
+// different --type (see wipe --all).
+func (c *cluster) wipeAll() {
+	c.wipe()
+	display := fmt.Sprintf("%s: cleaning", c.name)
+	c.stopNodes(display, func(index int) string {
+		cmd := `pkill -9 "cockroach|java|mongo" || true ;
 `
-		cmd += fmt.Sprintf("kill -9 $(lsof -t -i :%d -i :%d) 2>/dev/null || true ;\n",
-			cockroach{}.nodePort(c, c.nodes[i]),
-			cassandra{}.nodePort(c, c.nodes[i]))
+		cmd += fmt.Sprintf("kill -9 $(lsof -t %s) 2>/dev/null || true ;\n",
+			c.portFlags(index))
 		if c.isLocal() {
 			cmd += `rm -fr ${HOME}/local ;`
 		} else {
 			cmd += `find /mnt/data* -maxdepth 1 -type f -exec rm -f {} \; ;
-rm -fr /mnt/data*/{auxiliary,local,tmp,cassandra,cockroach,cockroach-temp*,mongo-data} \; ;
+rm -fr /mnt/data*/{auxiliary,local,tmp,cassandra,cockroach,cockroach-temp*,mongo-data,postgres,roachperf-snapshot} \; ;
 `
 		}
-		return session.CombinedOutput(cmd)
+		return cmd
 	})
 }
 
 func (c *cluster) status() {
+	c.impl.status(c)
+}
+
+// killLoadCmd kills any load generators and haproxy. It is run on every node
+// when a cluster is stopped or wiped.
+const killLoadCmd = `pkill -9 "kv|ycsb|haproxy" || true ;
+`
+
+// stopNodes kills any load generators and then runs the command returned by
+// fn for each node in the cluster in parallel.
+func (c *cluster) stopNodes(display string, fn func(index int) string) {
+	c.parallel(display, len(c.nodes), 0, func(i int) ([]byte, error) {
+		session, err := newSSHSession(c.user(c.nodes[i]), c.host(c.nodes[i]))
+		if err != nil {
+			return nil, err
+		}
+		defer session.Close()
+
+		return session.CombinedOutput(killLoadCmd + fn(c.nodes[i]))
+	})
+}
+
+// printStatus runs the command returned by fn for each node in the cluster in
+// parallel and prints the output. A node with no output is reported as not
+// running.
+func (c *cluster) printStatus(fn func(index int) string) {
 	display := fmt.Sprintf("%s: status", c.name)
 	results := make([]string, len(c.nodes))
 	c.parallel(display, len(c.nodes), 0, func(i int) ([]byte, error) {
@@ -142,18 +176,7 @@ func (c *cluster) status() {
 		}
 		defer session.Close()
 
-		cmd := fmt.Sprintf("out=$(lsof -i :%d -i :%d -sTCP:LISTEN",
-			cockroach{}.nodePort(c, c.nodes[i]),
-			cassandra{}.nodePort(c, c.nodes[i]))
-		cmd += ` | awk '!/COMMAND/ {print $1, $2}' | sort | uniq);
-vers=$(` + binary + ` version 2>/dev/null | awk '/Build Tag:/ {print $NF}')
-if [ -n "${out}" -a -n "${vers}" ]; then
-  echo ${out} | sed "s/cockroach/cockroach-${vers}/g"
-else
-  echo ${out}
-fi
-`
-		out, err := session.CombinedOutput(cmd)
+		out, err := session.CombinedOutput(fn(c.nodes[i]))
 		var msg string
 		if err != nil {
 			msg = err.Error()
@@ -242,14 +265,27 @@ func (c *cluster) runLoad(cmd string, stdout, stderr io.Writer) error {
 		log.Fatalf("%s: no load generator node specified", c.name)
 	}
 
-	display := fmt.Sprintf("%s: retrieving IP addresses", c.name)
-	nodes := c.serverNodes()
-	ips := make([]string, len(nodes))
-	c.parallel(display, len(nodes), 0, func(i int) ([]byte, error) {
-		var err error
-		ips[i], err = c.getInternalIP(nodes[i])
-		return nil, err
-	})
+	var urls []string
+	if c.haproxy {
+		// Direct all load at the haproxy instance running on the load generator
+		// node rather than at the individual nodes.
+		if err := c.startHAProxy(); err != nil {
+			return err
+		}
+		urls = append(urls, c.impl.nodeURL(c, "localhost", haproxyPort))
+	} else {
+		display := fmt.Sprintf("%s: retrieving IP addresses", c.name)
+		nodes := c.impl.loadNodes(c)
+		ips := make([]string, len(nodes))
+		c.parallel(display, len(nodes), 0, func(i int) ([]byte, error) {
+			var err error
+			ips[i], err = c.getInternalIP(nodes[i])
+			return nil, err
+		})
+		for i, ip := range ips {
+			urls = append(urls, c.impl.nodeURL(c, ip, c.impl.nodePort(c, nodes[i])))
+		}
+	}
 
 	session, err := newSSHSession(c.user(c.loadGen), c.host(c.loadGen))
 	if err != nil {
@@ -273,11 +309,6 @@ func (c *cluster) runLoad(cmd string, stdout, stderr io.Writer) error {
 	session.Stdout = stdout
 	session.Stderr = stderr
 	fmt.Fprintln(stdout, cmd)
-
-	var urls []string
-	for i, ip := range ips {
-		urls = append(urls, c.impl.nodeURL(c, ip, c.impl.nodePort(c, nodes[i])))
-	}
 	return session.Run("ulimit -n 16384; " + cmd + " " + strings.Join(urls, " "))
 }
 
@@ -468,9 +499,8 @@ func (c *cluster) stopLoad() {
 		}
 		defer session.Close()
 
-		cmd := fmt.Sprintf("kill -9 $(lsof -t -i :%d -i :%d) 2>/dev/null || true",
-			cockroach{}.nodePort(c, c.nodes[i]),
-			cassandra{}.nodePort(c, c.nodes[i]))
+		cmd := fmt.Sprintf("kill -9 $(lsof -t %s -i :%d) 2>/dev/null || true",
+			c.portFlags(c.nodes[i]), haproxyPort)
 		return session.CombinedOutput(cmd)
 	})
 }
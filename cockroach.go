@@ -9,7 +9,6 @@ type cockroach struct{}
 
 func (r cockroach) start(c *cluster) {
 	display := fmt.Sprintf("%s: starting", c.name)
-	host1 := c.host(1)
 	nodes := c.serverNodes()
 	c.parallel(display, len(nodes), 0, func(i int) ([]byte, error) {
 		host := c.host(nodes[i])
@@ -20,44 +19,7 @@ func (r cockroach) start(c *cluster) {
 		}
 		defer session.Close()
 
-		port := r.nodePort(c, nodes[i])
-
-		var args []string
-		if c.secure {
-			args = append(args, "--certs-dir=certs")
-		} else {
-			args = append(args, "--insecure")
-		}
-		dir := "/mnt/data1/cockroach"
-		if c.isLocal() {
-			dir = fmt.Sprintf("${HOME}/local/cockroach%d", nodes[i])
-		}
-		args = append(args, "--store=path="+dir)
-		args = append(args, "--logtostderr")
-		args = append(args, "--log-dir=")
-		args = append(args, "--background")
-		cache := 25
-		if c.isLocal() {
-			cache /= len(nodes)
-			if cache == 0 {
-				cache = 1
-			}
-		}
-		args = append(args, fmt.Sprintf("--cache=%d%%", cache))
-		args = append(args, fmt.Sprintf("--max-sql-memory=%d%%", cache))
-		args = append(args, fmt.Sprintf("--port=%d", port))
-		args = append(args, fmt.Sprintf("--http-port=%d", port+1))
-		if locality := c.locality(nodes[i]); locality != "" {
-			args = append(args, "--locality="+locality)
-		}
-		if nodes[i] != 1 {
-			args = append(args, fmt.Sprintf("--join=%s:%d", host1, r.nodePort(c, 1)))
-		}
-		args = append(args, c.args...)
-		cmd := "mkdir -p " + dir + "/logs; " +
-			c.env + " " + binary + " start " + strings.Join(args, " ") +
-			" > " + dir + "/logs/cockroach.stdout 2> " + dir + "/logs/cockroach.stderr"
-		return session.CombinedOutput(cmd)
+		return session.CombinedOutput(r.startCmd(c, nodes[i]))
 	})
 
 	// Check to see if node 1 was started indicating the cluster was
@@ -97,6 +59,108 @@ set cluster setting server.remote_debugging.mode = 'any';
 	}
 }
 
+// startCmd returns the command starting the specified node in the background.
+func (r cockroach) startCmd(c *cluster, index int) string {
+	port := r.nodePort(c, index)
+	nodes := c.serverNodes()
+
+	var args []string
+	if c.secure {
+		args = append(args, "--certs-dir=certs")
+	} else {
+		args = append(args, "--insecure")
+	}
+	dir := r.dataDir(c, index)
+	args = append(args, "--store=path="+dir)
+	args = append(args, "--logtostderr")
+	args = append(args, "--log-dir=")
+	args = append(args, "--background")
+	cache := 25
+	if c.isLocal() {
+		cache /= len(nodes)
+		if cache == 0 {
+			cache = 1
+		}
+	}
+	args = append(args, fmt.Sprintf("--cache=%d%%", cache))
+	args = append(args, fmt.Sprintf("--max-sql-memory=%d%%", cache))
+	args = append(args, fmt.Sprintf("--port=%d", port))
+	args = append(args, fmt.Sprintf("--http-port=%d", port+1))
+	if locality := c.locality(index); locality != "" {
+		args = append(args, "--locality="+locality)
+	}
+	if index != 1 {
+		args = append(args, fmt.Sprintf("--join=%s:%d", c.host(1), r.nodePort(c, 1)))
+	}
+	args = append(args, c.args...)
+	return "mkdir -p " + dir + "/logs; " +
+		c.env + " " + binary + " start " + strings.Join(args, " ") +
+		" > " + dir + "/logs/cockroach.stdout 2> " + dir + "/logs/cockroach.stderr"
+}
+
+func (r cockroach) restartCmd(c *cluster, index int) (string, error) {
+	return r.startCmd(c, index), nil
+}
+
+func (r cockroach) stop(c *cluster) {
+	display := fmt.Sprintf("%s: stopping", c.name)
+	c.stopNodes(display, func(index int) string {
+		return r.killCmd(c, index)
+	})
+}
+
+func (r cockroach) wipe(c *cluster) {
+	display := fmt.Sprintf("%s: wiping", c.name)
+	c.stopNodes(display, func(index int) string {
+		cmd := r.killCmd(c, index)
+		if c.isLocal() {
+			cmd += fmt.Sprintf("rm -fr ${HOME}/local/cockroach%[1]d ${HOME}/local/snapshot%[1]d ;", index)
+		} else {
+			cmd += `find /mnt/data* -maxdepth 1 -type f -exec rm -f {} \; ;
+rm -fr /mnt/data*/{auxiliary,local,tmp,cockroach,cockroach-temp*,roachperf-snapshot} \; ;
+`
+		}
+		return cmd
+	})
+}
+
+// dataDir returns the store directory of the specified node.
+func (cockroach) dataDir(c *cluster, index int) string {
+	if c.isLocal() {
+		return fmt.Sprintf("${HOME}/local/cockroach%d", index)
+	}
+	return "/mnt/data1/cockroach"
+}
+
+// snapshotDir returns the directory holding the snapshot of the store of the
+// specified node. It is removed by wipe and at the end of the test.
+func (cockroach) snapshotDir(c *cluster, index int) string {
+	if c.isLocal() {
+		return fmt.Sprintf("${HOME}/local/snapshot%d", index)
+	}
+	return "/mnt/data1/roachperf-snapshot"
+}
+
+func (r cockroach) killCmd(c *cluster, index int) string {
+	return fmt.Sprintf(`pkill -9 cockroach || true ;
+kill -9 $(lsof -t -i :%d) 2>/dev/null || true ;
+`, r.nodePort(c, index))
+}
+
+func (r cockroach) status(c *cluster) {
+	c.printStatus(func(index int) string {
+		return fmt.Sprintf("out=$(lsof -i :%d -sTCP:LISTEN", r.nodePort(c, index)) +
+			` | awk '!/COMMAND/ {print $1, $2}' | sort | uniq);
+vers=$(` + binary + ` version 2>/dev/null | awk '/Build Tag:/ {print $NF}')
+if [ -n "${out}" -a -n "${vers}" ]; then
+  echo ${out} | sed "s/cockroach/cockroach-${vers}/g"
+else
+  echo ${out}
+fi
+`
+	})
+}
+
 func (cockroach) nodeURL(c *cluster, host string, port int) string {
 	url := fmt.Sprintf("'postgres://root@%s:%d", host, port)
 	if c.secure {
@@ -117,3 +181,7 @@ func (cockroach) nodePort(c *cluster, index int) int {
 	}
 	return port
 }
+
+func (cockroach) loadNodes(c *cluster) []int {
+	return c.serverNodes()
+}
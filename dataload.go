@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// loadRows is the number of rows inserted by the load phase of the tests which
+// have one.
+var loadRows = 1000000
+
+// The events bracketing the load phase of a run.
+const (
+	loadDataEvent = "load-data"
+	loadedEvent   = "loaded"
+)
+
+// loadData runs the load phase of a test, inserting the initial dataset before
+// the measured load. The output of the load phase is written to <run>.load and
+// its duration is recorded in the event log of the run.
+func loadData(c *cluster, dir, run string, m *testMetadata, events *eventLog) error {
+	f, err := os.Create(filepath.Join(dir, run+".load"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	cmd := fmt.Sprintf(m.Load, m.LoadRows)
+	stdout := io.MultiWriter(f, os.Stdout)
+	stderr := io.MultiWriter(f, os.Stderr)
+	events.record(loadDataEvent, "%s", cmd)
+	if err := c.runLoad(cmd, stdout, stderr); err != nil {
+		events.record("error", "%s", err)
+		return err
+	}
+	events.record(loadedEvent, "%d rows", m.LoadRows)
+	return nil
+}
+
+// loadPhaseRun returns the load phase recorded in the events of a run as a run
+// named "load", or nil if the run has no completed load phase. The operations
+// of the load phase are the rows inserted.
+func loadPhaseRun(events []runEvent, rows int) *testRun {
+	var start *runEvent
+	for i := range events {
+		switch events[i].Kind {
+		case loadDataEvent:
+			start = &events[i]
+		case loadedEvent:
+			if start == nil {
+				continue
+			}
+			r := &testRun{
+				Name:    "load",
+				Elapsed: events[i].Time.Sub(start.Time).Seconds(),
+				Ops:     int64(rows),
+			}
+			if r.Elapsed > 0 {
+				r.OpsSec = float64(rows) / r.Elapsed
+			}
+			return r
+		}
+	}
+	return nil
+}
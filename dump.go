@@ -1,50 +1,434 @@
 package main
 
 import (
+	"encoding/csv"
 	"fmt"
+	"math"
+	"os"
+	"strings"
 )
 
-func dump(dirs []string) error {
-	switch n := len(dirs); n {
-	case 0:
-		return fmt.Errorf("no test directory specified")
-	case 1, 2:
-		d1, err := loadTestData(dirs[0])
+var dumpFormat = "text"
+
+// compareBaseline is the 1-based index of the test which other tests are
+// compared against.
+var compareBaseline = 1
+
+// loadCompareData loads the test data for the specified directories, placing
+// the baseline (1-based) first.
+func loadCompareData(dirs []string, baseline int) ([]*testData, error) {
+	if baseline < 1 || baseline > len(dirs) {
+		return nil, fmt.Errorf("invalid baseline %d: expected 1-%d", baseline, len(dirs))
+	}
+	ds := make([]*testData, 0, len(dirs))
+	for i, dir := range dirs {
+		d, err := loadTestData(dir)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		if n == 1 {
-			return dump1(d1)
+		if i+1 == baseline {
+			ds = append([]*testData{d}, ds...)
+		} else {
+			ds = append(ds, d)
 		}
-		d2, err := loadTestData(dirs[1])
-		if err != nil {
-			return err
+	}
+	return ds, nil
+}
+
+func dump(dirs []string) error {
+	switch dumpFormat {
+	case "text", "json", "csv", "markdown", "benchstat":
+	default:
+		return fmt.Errorf("unknown format: %s", dumpFormat)
+	}
+	if len(dirs) == 0 {
+		return fmt.Errorf("no test directory specified")
+	}
+
+	ds, err := loadCompareData(dirs, compareBaseline)
+	if err != nil {
+		return err
+	}
+	switch len(ds) {
+	case 1:
+		switch dumpFormat {
+		case "json":
+			return dumpJSON(ds[0])
+		case "csv":
+			return dump1CSV(ds[0])
+		case "markdown":
+			return dump1Markdown(ds[0])
+		case "benchstat":
+			return dumpBenchstat(testDirName(dirs[0]), ds[0])
 		}
-		return dump2(d1, d2)
+		return dump1(ds[0])
 	default:
-		return fmt.Errorf("too many test directories: %s", dirs)
+		switch dumpFormat {
+		case "json":
+			return dumpNJSON(ds)
+		case "csv":
+			return dumpNCSV(ds)
+		case "markdown":
+			return dumpNMarkdown(ds)
+		case "benchstat":
+			return fmt.Errorf("benchstat compares files: dump each test separately")
+		}
+		return dumpN(ds)
 	}
 }
 
 func dump1(d *testData) error {
 	fmt.Println(d.Metadata.Test)
+	if slo := d.Metadata.SLO; slo != nil && slo.Concurrency > 0 {
+		var approx string
+		if d.Metadata.measureStart() > 0 {
+			approx = " (approximate p99)"
+		}
+		fmt.Printf("max throughput with p99 <= %.1fms: %.1f ops/sec (concurrency=%d p99=%.1fms)%s\n",
+			slo.P99Target, slo.OpsSec, slo.Concurrency, slo.P99Lat, approx)
+	}
+	warmup, ramp := d.Metadata.excluded()
+	if ramp > 0 {
+		fmt.Printf("ramping up the concurrency over %s before each run\n", ramp)
+	}
+	if warmup > 0 {
+		fmt.Printf("excluding the first %s of each run (warm-up)\n", warmup)
+	}
+	if note := approximateNote(d.Runs); note != "" {
+		fmt.Println(note)
+	}
+	if d.Load != nil {
+		fmt.Println(formatLoad(d.Load))
+	}
 	fmt.Println("_____N_____ops/sec__avg(ms)__p50(ms)__p95(ms)__p99(ms)")
 	for _, r := range d.Runs {
-		fmt.Printf("%6d %11.1f %8.1f %8.1f %8.1f %8.1f\n", r.Concurrency,
+		fmt.Printf("%6s %11.1f %8.1f %8.1f %8.1f %8.1f\n", r.key(),
 			r.OpsSec, r.AvgLat, r.P50Lat, r.P95Lat, r.P99Lat)
 	}
+	if names := metricsHeader(d.Runs); len(names) > 0 {
+		fmt.Printf("\nnode metrics\n%6s", "N")
+		for _, name := range names {
+			fmt.Printf(" %11s", name)
+		}
+		fmt.Println()
+		for _, r := range d.Runs {
+			fmt.Printf("%6s", r.key())
+			for _, v := range metricsRecord(r, names) {
+				fmt.Printf(" %11s", v)
+			}
+			fmt.Println()
+		}
+	}
+	return nil
+}
+
+// formatLoad describes the load phase of a test.
+func formatLoad(l *testRun) string {
+	return fmt.Sprintf("load: %d rows in %.1fs (%.1f rows/sec)", l.Ops, l.Elapsed, l.OpsSec)
+}
+
+func formatStat(v float64) string {
+	if math.IsNaN(v) {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f", v)
+}
+
+func formatP(p float64) string {
+	if math.IsNaN(p) {
+		return "-"
+	}
+	return fmt.Sprintf("%.3f", p)
+}
+
+var runHeader = []string{
+	"run", "concurrency", "elapsed", "errors", "ops",
+	"ops/sec", "avg(ms)", "p50(ms)", "p95(ms)", "p99(ms)",
+}
+
+func runRecord(r *testRun) []string {
+	return []string{
+		r.key(),
+		fmt.Sprint(r.Concurrency),
+		fmt.Sprintf("%.1f", r.Elapsed),
+		fmt.Sprint(r.Errors),
+		fmt.Sprint(r.Ops),
+		fmt.Sprintf("%.1f", r.OpsSec),
+		fmt.Sprintf("%.1f", r.AvgLat),
+		fmt.Sprintf("%.1f", r.P50Lat),
+		fmt.Sprintf("%.1f", r.P95Lat),
+		fmt.Sprintf("%.1f", r.P99Lat),
+	}
+}
+
+// dumpJSON outputs the metadata and all of the fields of every run,
+// including the individual samples of repeated runs.
+func dumpJSON(d *testData) error {
+	fmt.Println(prettyJSON(d))
 	return nil
 }
 
-func dump2(d1, d2 *testData) error {
-	d1, d2 = alignTestData(d1, d2)
-	fmt.Println(d1.Metadata.Test)
-	fmt.Println("_____N__ops/sec(1)__ops/sec(2)_____delta")
-	for i := range d1.Runs {
-		r1 := d1.Runs[i]
-		r2 := d2.Runs[i]
-		fmt.Printf("%6d %11.1f %11.1f %8.2f%%\n",
-			r1.Concurrency, r1.OpsSec, r2.OpsSec, 100*(r2.OpsSec-r1.OpsSec)/r1.OpsSec)
+func dump1CSV(d *testData) error {
+	w := csv.NewWriter(os.Stdout)
+	_ = w.Write(runHeader)
+	for _, r := range d.Runs {
+		_ = w.Write(runRecord(r))
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func dump1Markdown(d *testData) error {
+	fmt.Printf("`%s` (%s)\n\n", d.Metadata.Test, d.Metadata.Bin)
+	var rows [][]string
+	for _, r := range d.Runs {
+		rows = append(rows, runRecord(r))
+	}
+	printMarkdownTable(runHeader, rows)
+	if note := approximateNote(d.Runs); note != "" {
+		fmt.Printf("\nThe %s.\n", note)
+	}
+	return nil
+}
+
+func printMarkdownTable(header []string, rows [][]string) {
+	fmt.Printf("| %s |\n", strings.Join(header, " | "))
+	fmt.Printf("|%s\n", strings.Repeat("---|", len(header)))
+	for _, r := range rows {
+		fmt.Printf("| %s |\n", strings.Join(r, " | "))
+	}
+}
+
+// dumpBenchstat outputs the runs in the Go benchmark format understood by
+// benchstat. Each repetition of a run is output as a separate iteration so
+// that benchstat can compute its own statistics. The Go tooling only treats
+// names where "Benchmark" is followed by an upper case letter as benchmarks,
+// so the test name is capitalized (e.g. BenchmarkKv_95).
+func dumpBenchstat(name string, d *testData) error {
+	name = strings.ToUpper(name[:1]) + name[1:]
+	fmt.Printf("bin: %s\n", d.Metadata.Bin)
+	for _, r := range d.Runs {
+		samples := r.Samples
+		if len(samples) == 0 {
+			samples = []*testRun{r}
+		}
+		for _, s := range samples {
+			fmt.Printf("Benchmark%s/run=%s %d %.1f ops/s %.1f avg-ms %.1f p50-ms %.1f p95-ms %.1f p99-ms\n",
+				name, r.key(), s.Ops, s.OpsSec, s.AvgLat, s.P50Lat, s.P95Lat, s.P99Lat)
+		}
+	}
+	return nil
+}
+
+// multiCompareRow holds the statistics of a metric for one run of each test,
+// along with the comparison of each test against the baseline (the first
+// test). The baseline's comparison is against itself.
+type multiCompareRow struct {
+	Metric      string
+	Key         string
+	Comparisons []comparison
+}
+
+// compareTestDataN compares each metric of the runs in aligned test data
+// against the first test, followed by the key metrics of the nodes and the
+// throughput of the load phases if every test has one.
+func compareTestDataN(ds []*testData) []multiCompareRow {
+	var rows []multiCompareRow
+	for _, m := range append(append([]metric(nil), metrics...), compareNodeMetrics(ds)...) {
+		for i, r := range ds[0].Runs {
+			row := multiCompareRow{
+				Metric:      m.name,
+				Key:         r.key(),
+				Comparisons: make([]comparison, len(ds)),
+			}
+			for j, d := range ds {
+				row.Comparisons[j] = compareRuns(m, r, d.Runs[i])
+			}
+			rows = append(rows, row)
+		}
+	}
+	for _, d := range ds {
+		if d.Load == nil {
+			return rows
+		}
+	}
+	row := multiCompareRow{
+		Metric:      "load(rows/sec)",
+		Key:         "load",
+		Comparisons: make([]comparison, len(ds)),
+	}
+	for j, d := range ds {
+		row.Comparisons[j] = compareRuns(metrics[0], ds[0].Load, d.Load)
+	}
+	return append(rows, row)
+}
+
+func dumpN(ds []*testData) error {
+	ds = alignTestDataN(ds)
+	fmt.Println(ds[0].Metadata.Test)
+	for i, d := range ds {
+		var base string
+		if i == 0 {
+			base = " (baseline)"
+		}
+		fmt.Printf("(%d) %s %s%s\n", i+1, d.Metadata.Bin, d.Metadata.Date, base)
+		if d.Load != nil {
+			fmt.Printf("    %s\n", formatLoad(d.Load))
+		}
+	}
+
+	header := "_____N" + fmt.Sprintf("%11s%12s%10s", "mean(1)", "stddev(1)", "95ci(1)")
+	for i := 2; i <= len(ds); i++ {
+		header += fmt.Sprintf("%11s%12s%10s%11s%13s",
+			fmt.Sprintf("mean(%d)", i), fmt.Sprintf("stddev(%d)", i), fmt.Sprintf("95ci(%d)", i),
+			fmt.Sprintf("delta(%d)", i), fmt.Sprintf("p-value(%d)", i))
+	}
+	header = strings.Replace(header, " ", "_", -1)
+
+	var last string
+	for _, r := range compareTestDataN(ds) {
+		if r.Metric != last {
+			last = r.Metric
+			fmt.Printf("\n%s\n%s\n", r.Metric, header)
+		}
+		base := r.Comparisons[0].Base
+		fmt.Printf("%6s %10s %11s %9s", r.Key,
+			formatStat(base.Mean), formatStat(base.Stddev), formatStat(base.CI))
+		for _, c := range r.Comparisons[1:] {
+			fmt.Printf(" %10s %11s %9s %10s %12s",
+				formatStat(c.New.Mean), formatStat(c.New.Stddev), formatStat(c.New.CI),
+				formatDelta(c), formatP(c.P))
+		}
+		fmt.Println()
+	}
+	fmt.Printf("\n* statistically significant (p < %.2f, Welch's t-test)\n", significanceLevel)
+	if note := approximateNote(allRuns(ds)); note != "" {
+		fmt.Println(note)
+	}
+	return nil
+}
+
+// allRuns returns the runs of all of the tests.
+func allRuns(ds []*testData) []*testRun {
+	var runs []*testRun
+	for _, d := range ds {
+		runs = append(runs, d.Runs...)
+	}
+	return runs
+}
+
+func formatPercent(v float64) string {
+	if math.IsNaN(v) {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f%%", v)
+}
+
+func formatDelta(c comparison) string {
+	s := formatPercent(c.Delta)
+	if c.Significant {
+		s += "*"
+	}
+	return s
+}
+
+func multiCompareHeader(n int) []string {
+	header := []string{"metric", "run", "mean(1)", "stddev(1)", "95ci(1)"}
+	for i := 2; i <= n; i++ {
+		header = append(header,
+			fmt.Sprintf("mean(%d)", i), fmt.Sprintf("stddev(%d)", i), fmt.Sprintf("95ci(%d)", i),
+			fmt.Sprintf("delta(%d)(%%)", i), fmt.Sprintf("p-value(%d)", i))
+	}
+	return header
+}
+
+func multiCompareRecord(r multiCompareRow) []string {
+	base := r.Comparisons[0].Base
+	rec := []string{
+		r.Metric, r.Key, formatStat(base.Mean), formatStat(base.Stddev), formatStat(base.CI),
+	}
+	for _, c := range r.Comparisons[1:] {
+		rec = append(rec,
+			formatStat(c.New.Mean), formatStat(c.New.Stddev), formatStat(c.New.CI),
+			formatStat(c.Delta), formatP(c.P))
+	}
+	return rec
+}
+
+func dumpNJSON(ds []*testData) error {
+	ds = alignTestDataN(ds)
+	type row struct {
+		Metric string
+		Run    string
+		Mean   []jsonFloat
+		Stddev []jsonFloat
+		CI     []jsonFloat
+		// Delta, P and Significant are relative to the baseline (the first
+		// test).
+		Delta       []jsonFloat
+		P           []jsonFloat
+		Significant []bool
+	}
+	var rows []row
+	for _, r := range compareTestDataN(ds) {
+		j := row{Metric: r.Metric, Run: r.Key}
+		for _, c := range r.Comparisons {
+			j.Mean = append(j.Mean, jsonFloat(c.New.Mean))
+			j.Stddev = append(j.Stddev, jsonFloat(c.New.Stddev))
+			j.CI = append(j.CI, jsonFloat(c.New.CI))
+			j.Delta = append(j.Delta, jsonFloat(c.Delta))
+			j.P = append(j.P, jsonFloat(c.P))
+			j.Significant = append(j.Significant, c.Significant)
+		}
+		rows = append(rows, j)
+	}
+	fmt.Println(prettyJSON(struct {
+		Tests       []*testData
+		Comparisons []row
+	}{ds, rows}))
+	return nil
+}
+
+func dumpNCSV(ds []*testData) error {
+	ds = alignTestDataN(ds)
+	w := csv.NewWriter(os.Stdout)
+	_ = w.Write(multiCompareHeader(len(ds)))
+	for _, r := range compareTestDataN(ds) {
+		_ = w.Write(multiCompareRecord(r))
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func dumpNMarkdown(ds []*testData) error {
+	ds = alignTestDataN(ds)
+	fmt.Printf("`%s`\n\n", ds[0].Metadata.Test)
+	for i, d := range ds {
+		var base string
+		if i == 0 {
+			base = " (baseline)"
+		}
+		fmt.Printf("%d. %s %s%s\n", i+1, d.Metadata.Bin, d.Metadata.Date, base)
+		if d.Load != nil {
+			fmt.Printf("   %s\n", formatLoad(d.Load))
+		}
+	}
+	fmt.Println()
+	var rows [][]string
+	for _, r := range compareTestDataN(ds) {
+		rec := multiCompareRecord(r)
+		for i, c := range r.Comparisons[1:] {
+			if c.Significant {
+				j := 5 + 5*i + 3
+				rec[j] = "**" + rec[j] + "**"
+			}
+		}
+		rows = append(rows, rec)
+	}
+	printMarkdownTable(multiCompareHeader(len(ds)), rows)
+	fmt.Printf("\nSignificant p-values (p < %.2f, Welch's t-test) are in bold.\n", significanceLevel)
+	if note := approximateNote(allRuns(ds)); note != "" {
+		fmt.Printf("\nThe %s.\n", note)
 	}
 	return nil
 }
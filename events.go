@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// runEvent is an event which occurred during a test run, such as a node being
+// started or killed. The events of a run are stored one per line as JSON in
+// <dir>/<run>.events.
+type runEvent struct {
+	Time    time.Time
+	Kind    string
+	Message string `json:",omitempty"`
+}
+
+// loadEvent marks the start of the load. The elapsed time of the other events
+// of a run is relative to it.
+const loadEvent = "load"
+
+type eventLog struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+func eventsPath(dir, run string) string {
+	return filepath.Join(dir, run+".events")
+}
+
+// newEventLog creates the event log for a run, replacing the events of any
+// previous attempt at the run.
+func newEventLog(dir, run string) (*eventLog, error) {
+	f, err := os.Create(eventsPath(dir, run))
+	if err != nil {
+		return nil, err
+	}
+	return &eventLog{f: f}, nil
+}
+
+// record appends an event to the log. Events are written immediately so that
+// they are visible while the run is in progress.
+func (l *eventLog) record(kind, format string, args ...interface{}) {
+	if l == nil {
+		return
+	}
+	e := runEvent{
+		Time:    time.Now(),
+		Kind:    kind,
+		Message: fmt.Sprintf(format, args...),
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = l.f.Write(append(data, '\n'))
+}
+
+func (l *eventLog) Close() error {
+	if l == nil {
+		return nil
+	}
+	return l.f.Close()
+}
+
+// loadRunEvents returns the events of a run. A run without an event log has
+// no events.
+func loadRunEvents(dir, run string) ([]runEvent, error) {
+	f, err := os.Open(eventsPath(dir, run))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var events []runEvent
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		var e runEvent
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, s.Err()
+}
+
+// recordLoad records the completion or failure of the load and returns err.
+func recordLoad(l *eventLog, err error) error {
+	if err != nil {
+		l.record("error", "%s", err)
+	} else {
+		l.record("done", "")
+	}
+	return err
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+)
+
+// haproxyPort is the port haproxy listens on for SQL connections. It differs
+// from the cockroach port so that haproxy can run alongside the nodes of a
+// local cluster.
+const haproxyPort = 26256
+
+func (c *cluster) startHAProxy() error {
+	if clusterType != "cockroach" {
+		return fmt.Errorf("haproxy is only supported for cockroach clusters")
+	}
+	if c.loadGen <= 0 {
+		return fmt.Errorf("%s: no load generator node specified", c.name)
+	}
+
+	// Generate the haproxy config on the load generator node using the first
+	// server node to discover the other nodes in the cluster.
+	node := c.serverNodes()[0]
+	ip, err := c.getInternalIP(node)
+	if err != nil {
+		return err
+	}
+
+	display := fmt.Sprintf("%s: starting haproxy", c.name)
+	c.parallel(display, 1, 0, func(i int) ([]byte, error) {
+		session, err := newSSHSession(c.user(c.loadGen), c.host(c.loadGen))
+		if err != nil {
+			return nil, err
+		}
+		defer session.Close()
+
+		certs := "--insecure"
+		if c.secure {
+			certs = "--certs-dir=certs"
+		}
+		cmd := fmt.Sprintf(`pkill -9 haproxy || true ;
+%s gen haproxy %s --host=%s --port=%d &&
+sed -i 's/^\( *bind *\):[0-9]*/\1:%d/' haproxy.cfg &&
+haproxy -f haproxy.cfg -D
+`, binary, certs, ip, c.impl.nodePort(c, node), haproxyPort)
+		return session.CombinedOutput(cmd)
+	})
+	return nil
+}
+
+func (c *cluster) stopHAProxy() error {
+	if c.loadGen <= 0 {
+		return fmt.Errorf("%s: no load generator node specified", c.name)
+	}
+
+	display := fmt.Sprintf("%s: stopping haproxy", c.name)
+	c.parallel(display, 1, 0, func(i int) ([]byte, error) {
+		session, err := newSSHSession(c.user(c.loadGen), c.host(c.loadGen))
+		if err != nil {
+			return nil, err
+		}
+		defer session.Close()
+
+		return session.CombinedOutput(`pkill -9 haproxy || true`)
+	})
+	return nil
+}
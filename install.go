@@ -31,10 +31,29 @@ sudo service cassandra stop;
 			}
 
 		case "mongodb":
-			return fmt.Errorf("TODO(peter): unimplemented: mongodb")
+			cmd := `
+sudo apt-key adv --keyserver hkp://keyserver.ubuntu.com:80 --recv 2930ADAE8CAF5059EE73BB4B58712A2291FA4AD5;
+echo "deb [ arch=amd64,arm64 ] https://repo.mongodb.org/apt/ubuntu $(lsb_release -cs)/mongodb-org/3.6 multiverse" | \
+  sudo tee /etc/apt/sources.list.d/mongodb-org-3.6.list;
+sudo apt-get update;
+sudo apt-get install -y mongodb-org;
+sudo service mongod stop;
+sudo systemctl disable mongod;
+`
+			if err := do("mongodb", cmd); err != nil {
+				return err
+			}
 
 		case "postgres":
-			return fmt.Errorf("TODO(peter): unimplemented: postgres")
+			cmd := `
+sudo apt-get update;
+sudo apt-get install -y postgresql;
+sudo service postgresql stop;
+sudo systemctl disable postgresql;
+`
+			if err := do("postgres", cmd); err != nil {
+				return err
+			}
 
 		case "tools":
 			cmd := `
@@ -4,8 +4,20 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"log"
+	"math"
 )
 
+// jsonFloat is a float64 which is encoded as null if it is not a finite number,
+// as JSON has no representation for NaN or infinity.
+type jsonFloat float64
+
+func (f jsonFloat) MarshalJSON() ([]byte, error) {
+	if math.IsNaN(float64(f)) || math.IsInf(float64(f), 0) {
+		return []byte("null"), nil
+	}
+	return json.Marshal(float64(f))
+}
+
 func prettyJSON(v interface{}) string {
 	data, err := json.MarshalIndent(v, "", "\t")
 	if err != nil {
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// lockDir is the directory containing the cluster lock files. A test holds the
+// lock of its cluster for the lifetime of the roachperf process so that tests
+// run interactively and by the scheduler do not run on a cluster concurrently.
+var lockDir = "${HOME}/.roachperf/locks"
+
+// exitClusterLocked is the exit status of a test which could not lock its
+// cluster. The scheduler queues such tests again rather than failing them.
+const exitClusterLocked = 75
+
+// heldLocks are the locks held by this process, keyed by path.
+var heldLocks = map[string]*os.File{}
+
+func clusterLockPath(name string) string {
+	return filepath.Join(os.ExpandEnv(lockDir), name+".lock")
+}
+
+// flockFile acquires an exclusive lock on the file at path without blocking.
+// The lock is held until the process exits. The file records the holder of
+// the lock.
+func flockFile(path string) error {
+	if heldLocks[path] != nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if err == syscall.EWOULDBLOCK {
+			return fmt.Errorf("%s is locked by %s", path, lockHolder(path))
+		}
+		return err
+	}
+	if err := f.Truncate(0); err != nil {
+		f.Close()
+		return err
+	}
+	fmt.Fprintf(f, "pid %d: %s\n", os.Getpid(), strings.Join(os.Args, " "))
+	heldLocks[path] = f
+	return nil
+}
+
+// isLocked returns true if the file at path is locked by another process.
+func isLocked(path string) bool {
+	if heldLocks[path] != nil {
+		return false
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_SH|syscall.LOCK_NB); err != nil {
+		return true
+	}
+	_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+	return false
+}
+
+func lockHolder(path string) string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil || len(data) == 0 {
+		return "another process"
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// lockCluster acquires the lock of the cluster for the lifetime of the process.
+func lockCluster(name string) error {
+	if err := flockFile(clusterLockPath(name)); err != nil {
+		return fmt.Errorf("%s: cluster is in use: %s", name, err)
+	}
+	return nil
+}
+
+func clusterLocked(name string) bool {
+	return isLocked(clusterLockPath(name))
+}
@@ -1,17 +1,10 @@
 // TODO:
 //
-// * Ease the creation of test metadata and then running a series of tests
-//   using `roachperf <cluster> test <dir1> <dir2> ...`. Perhaps something like
-//   `cockroach prepare <test> <binary>`.
-//
 // * Automatically detect stalled tests and restart tests upon unexpected
 //   failures. Detection of stalled tests could be done by noticing zero output
 //   for a period of time.
 //
 // * Detect crashed cockroach nodes.
-//
-// * Configure and run haproxy. (Assume it is already installed). This can be
-//   done by running "cockroach gen haproxy" after the cluster is started.
 
 package main
 
@@ -38,6 +31,8 @@ var secure = false
 var nodeEnv = "COCKROACH_ENABLE_RPC_COMPRESSION=false"
 var nodeArgs []string
 var binary = "./cockroach"
+var useHAProxy = false
+var wipeAllTypes = false
 
 func listNodes(s string, total int) ([]int, error) {
 	if s == "all" {
@@ -128,6 +123,10 @@ func newCluster(name string, reserveLoadGen bool) (*cluster, error) {
 		c.impl = cockroach{}
 	case "cassandra":
 		c.impl = cassandra{}
+	case "postgres":
+		c.impl = postgres{}
+	case "mongodb":
+		c.impl = mongodb{}
 	default:
 		return nil, fmt.Errorf("unknown cluster type: %s", clusterType)
 	}
@@ -159,6 +158,7 @@ func newCluster(name string, reserveLoadGen bool) (*cluster, error) {
 	c.secure = secure
 	c.env = nodeEnv
 	c.args = nodeArgs
+	c.haproxy = useHAProxy
 
 	if c.isLocal() {
 		var max int
@@ -228,13 +228,21 @@ var stopCmd = &cobra.Command{
 var wipeCmd = &cobra.Command{
 	Use:   "wipe",
 	Short: "wipe a cluster",
-	Long:  ``,
+	Long: `
+Wipe the data of the cluster type. With --all, the processes and data of every
+cluster type are removed, such as when the cluster was previously used with a
+different --type.
+`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		c, err := newCluster(clusterName, false /* reserveLoadGen */)
 		if err != nil {
 			return err
 		}
-		c.wipe()
+		if wipeAllTypes {
+			c.wipeAll()
+		} else {
+			c.wipe()
+		}
 		return nil
 	},
 }
@@ -253,6 +261,34 @@ var statusCmd = &cobra.Command{
 	},
 }
 
+var haproxyCmd = &cobra.Command{
+	Use:   "haproxy <start|stop>",
+	Short: "start or stop haproxy on the load generator node",
+	Long: `
+Start or stop haproxy on the load generator node (the last node in the
+cluster). The haproxy config is generated using "cockroach gen haproxy" and
+balances connections across all of the other nodes in the cluster. Assumes
+haproxy is already installed.
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return fmt.Errorf("expected start or stop")
+		}
+		c, err := newCluster(clusterName, true /* reserveLoadGen */)
+		if err != nil {
+			return err
+		}
+		switch args[0] {
+		case "start":
+			return c.startHAProxy()
+		case "stop":
+			return c.stopHAProxy()
+		default:
+			return fmt.Errorf("unknown haproxy command: %s", args[0])
+		}
+	},
+}
+
 var runCmd = &cobra.Command{
 	Use:   "run <command> [args]",
 	Short: "run a command on the nodes in a cluster",
@@ -299,6 +335,28 @@ tag 6151ae1.
 			fmt.Printf("no test specified\n\n")
 			return cmd.Help()
 		}
+		if _, err := parseConcurrency(concurrency, 1); err != nil {
+			return err
+		}
+		if _, err := sweepCombinations(sweeps); err != nil {
+			return err
+		}
+		if _, err := parseChaosSpecs(chaosSpecs); err != nil {
+			return err
+		}
+		if err := checkReuseMode(reuseMode); err != nil {
+			return err
+		}
+		if sloP99 > 0 && len(sweeps) > 0 {
+			return fmt.Errorf("--slo-p99 and --sweep cannot be combined")
+		}
+		if warmup > 0 || ramp > 0 {
+			for _, arg := range args {
+				if name := testName(arg); name == "nightly" || name == "splits" {
+					return fmt.Errorf("--warmup and --ramp are not supported by the %s test", name)
+				}
+			}
+		}
 		for _, arg := range args {
 			if err := runTest(arg, clusterName); err != nil {
 				return err
@@ -319,6 +377,52 @@ Upload the artifacts from a test. Currently supports s3 only as a backend.
 	},
 }
 
+var resultsCmd = &cobra.Command{
+	Use:   "results",
+	Short: "manage the results of previous tests",
+	Long: `
+Manage the index of test results stored in ~/.roachperf/results. Tests register
+their output directory automatically. A registered result can be referred to by
+its ID wherever a test directory is expected.
+`,
+}
+
+var resultsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "list test results",
+	Long:  ``,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return resultsList()
+	},
+}
+
+var resultsShowCmd = &cobra.Command{
+	Use:   "show <id>...",
+	Short: "show test results",
+	Long:  ``,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return resultsShow(args)
+	},
+}
+
+var resultsImportCmd = &cobra.Command{
+	Use:   "import <testdir>...",
+	Short: "add existing test directories to the results index",
+	Long:  ``,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return resultsImport(args)
+	},
+}
+
+var resultsDeleteCmd = &cobra.Command{
+	Use:   "delete <id>...",
+	Short: "remove test results from the results index",
+	Long:  ``,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return resultsDelete(args)
+	},
+}
+
 var installCmd = &cobra.Command{
 	Use:   "install <software>",
 	Short: "install 3rd party software",
@@ -344,10 +448,17 @@ are:
 }
 
 var webCmd = &cobra.Command{
-	Use:   "web <testdir> [<testdir>]",
+	Use:   "web <testdir> [<testdir>...]",
 	Short: "visualize and compare test output",
 	Long: `
-Visualize the output of a single test or compare the output of two tests.
+Visualize the output of a single test or compare the output of two tests. When
+more than two tests are specified an overview of the tests is displayed unless
+--compare is specified.
+
+With --serve, an HTTP server listing the specified tests (or, if none are
+specified, the registered results and the tests in the current directory) is
+started instead. Pages displaying a test in progress are refreshed
+periodically.
 `,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		return web(args)
@@ -355,14 +466,131 @@ Visualize the output of a single test or compare the output of two tests.
 }
 
 var dumpCmd = &cobra.Command{
-	Use:   "dump <testdir> [<testdir>]",
+	Use:   "dump <testdir> [<testdir>...]",
 	Short: "dump test output",
-	Long:  ``,
+	Long: `
+Dump the output of a single test or compare the output of multiple tests. The
+tests are compared against the --baseline test.
+`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		return dump(args)
 	},
 }
 
+var checkCmd = &cobra.Command{
+	Use:   "check <testdir>",
+	Short: "check test output for regressions",
+	Long: `
+Check the output of a test for regressions against a baseline. The baseline is
+either the output directory of a single test or a directory containing the
+output of previous tests, in which case all earlier runs of the same test are
+used.
+
+A metric regresses if it is worse than the baseline mean by more than the
+allowed percentage and, when the baseline contains multiple values, by more
+than --sigma standard deviations. Exits with a non-zero status if any metric
+regressed.
+`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return check(args)
+	},
+}
+
+var queueCmd = &cobra.Command{
+	Use:   "queue",
+	Short: "manage the queue of tests run by the scheduler",
+	Long: `
+Manage the queue of tests stored in ~/.roachperf/queue. Queued tests are run by
+the scheduler (see "roachperf scheduler").
+`,
+}
+
+var queueAddCmd = &cobra.Command{
+	Use:   "add <cluster> <test> [<test flags>...]",
+	Short: "add a test to the queue",
+	Long: `
+Add a test to the queue of a cluster. The test is either the name of a test or
+the output directory of a test to resume, followed by any flags of the test
+command. For example:
+
+	roachperf queue add denim kv_95 --duration=10m --concurrency=1-64
+`,
+	DisableFlagParsing: true,
+	SilenceUsage:       true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) > 0 && (args[0] == "-h" || args[0] == "--help") {
+			return cmd.Help()
+		}
+		if len(args) < 2 {
+			return fmt.Errorf("expected a cluster and a test")
+		}
+		return queueAdd(args[0], args[1:])
+	},
+}
+
+var queueListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "list the queued, running and completed tests",
+	Long:  ``,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return queueList()
+	},
+}
+
+var schedulerCmd = &cobra.Command{
+	Use:   "scheduler",
+	Short: "run the queued tests",
+	Long: `
+Run the tests in the queue until interrupted. The tests on a cluster are run one
+at a time in the order they were added, and the tests on different clusters are
+run in parallel. A test is not started while its cluster is in use by another
+test. The state of the queue is persisted, so restarting the scheduler resumes
+the tests which were interrupted. A test is only done once every run completed;
+a failed test is resumed by adding its output directory to the queue. The
+status of the queue is displayed by
+"roachperf queue list" and on the /queue page of "roachperf web --serve".
+`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return scheduler()
+	},
+}
+
+var matrixCmd = &cobra.Command{
+	Use:   "matrix <spec>",
+	Short: "run a matrix of tests across binaries, clusters and workloads",
+	Long: `
+Run every workload against every binary on every cluster configuration listed
+in a YAML spec. For example:
+
+	binaries: [./cockroach-v1.1, ./cockroach-v2.0]
+	workloads: [kv_0, kv_95]
+	clusters:
+	- cluster: denim
+	- name: denim-nocache
+	  cluster: denim
+	  args: [--cache=0]
+	duration: 5m
+	concurrency: 1-64
+
+The binaries are uploaded to the cluster before running the workloads against
+them. Each test is run by a separate roachperf process in a work directory per
+cluster configuration and binary within the matrix directory, and its output is
+logged to <workload>.log. Running the matrix again resumes it, skipping the
+completed tests and resuming the interrupted ones. Once the matrix completes,
+the peak throughput of each test is reported and an overview of the tests is
+written to report.html in the matrix directory.
+`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return fmt.Errorf("expected a single matrix spec")
+		}
+		return matrix(args[0])
+	},
+}
+
 var putCmd = &cobra.Command{
 	Use:   "put <src> [<dest>]",
 	Short: "copy a local file to the nodes in a cluster",
@@ -500,6 +728,7 @@ will perform <command> on:
 			wipeCmd,
 			pgurlCmd,
 			installCmd,
+			haproxyCmd,
 		)
 		cmd.PersistentFlags().BoolVar(
 			&secure, "secure", false, "use a secure cluster")
@@ -508,22 +737,123 @@ will perform <command> on:
 		cmd.PersistentFlags().StringVarP(
 			&nodeEnv, "env", "e", nodeEnv, "node environment variables")
 		cmd.PersistentFlags().StringVarP(
-			&clusterType, "type", "t", clusterType, `cluster type ("cockroach" or "cassandra")`)
+			&clusterType, "type", "t", clusterType, `cluster type ("cockroach", "cassandra", "postgres" or "mongodb")`)
+		cmd.PersistentFlags().StringVar(
+			&cassandraConfigFile, "cassandra-config", "",
+			"YAML file of cassandra.yaml overrides (directories, ports and addresses are set by roachperf)")
+		cmd.PersistentFlags().StringArrayVar(
+			&cassandraSettings, "cassandra-set", nil,
+			"cassandra.yaml override as <key>=<value> (nested keys are dotted, an empty value removes the key)")
+		cmd.PersistentFlags().BoolVar(
+			&postgresReplicas, "pg-replicas", false, "start postgres streaming replicas on all but the first node")
 		rootCmd.AddCommand(cmd)
 	}
 
-	rootCmd.AddCommand(dumpCmd, webCmd, uploadCmd)
+	resultsCmd.AddCommand(resultsListCmd, resultsShowCmd, resultsImportCmd, resultsDeleteCmd)
+	queueCmd.AddCommand(queueAddCmd, queueListCmd)
+	rootCmd.AddCommand(dumpCmd, webCmd, uploadCmd, checkCmd, resultsCmd, matrixCmd, queueCmd, schedulerCmd)
 
 	rootCmd.PersistentFlags().BoolVar(
 		&insecureIgnoreHostKey, "insecure-ignore-host-key", true, "don't check ssh host keys")
 	startCmd.PersistentFlags().StringVarP(
 		&binary, "binary", "b", "./cockroach", "the remote cockroach binary used to start a server")
+	resultsListCmd.Flags().StringVar(
+		&resultsFilter.test, "test", "", "only list results of the specified test (e.g. kv_95)")
+	resultsListCmd.Flags().StringVar(
+		&resultsFilter.cluster, "cluster", "", "only list results from the specified cluster")
+	resultsListCmd.Flags().StringVar(
+		&resultsFilter.bin, "bin", "", "only list results whose binary version contains the specified string")
+	resultsListCmd.Flags().StringVar(
+		&resultsFilter.since, "since", "", "only list results on or after the specified date (e.g. 2018-01-02)")
+	resultsListCmd.Flags().StringVar(
+		&resultsFilter.until, "until", "", "only list results on or before the specified date")
+	resultsListCmd.Flags().StringVar(
+		&resultsFilter.args, "args", "", "only list results whose node arguments contain the specified string")
+	matrixCmd.Flags().StringVar(
+		&matrixDir, "dir", "", "the matrix output directory (defaults to the spec name without its extension)")
+	matrixCmd.Flags().BoolVar(
+		&matrixParallel, "parallel", false, "run the tests on different clusters in parallel")
+	resultsDeleteCmd.Flags().BoolVar(
+		&resultsPurge, "purge", false, "also remove the test directory")
+	dumpCmd.Flags().IntVar(
+		&compareBaseline, "baseline", compareBaseline, "the test (1-based) which the other tests are compared against")
+	webCmd.Flags().IntVar(
+		&compareBaseline, "baseline", compareBaseline, "the test (1-based) which the other tests are compared against")
+	webCmd.Flags().StringVarP(
+		&webOutput, "output", "o", "", "write the results to the specified HTML file rather than opening them")
+	webCmd.Flags().StringVar(
+		&webServeAddr, "serve", "", "serve the results over HTTP on the specified address (e.g. :8080)")
+	webCmd.Flags().StringVar(
+		&webRunName, "run", "", "display the specified run (e.g. 64) over time, overlaying the run of each test")
+	webCmd.Flags().StringVar(
+		&webSummary, "summary", webSummary,
+		`the run summarizing each test in the overview ("peak" or the key of a run, e.g. 64 or kv_95)`)
+	webCmd.Flags().StringVar(
+		&webHistory, "history", "",
+		"display an overview of the tests in the specified directory (\"s3\" for the tests uploaded to S3,\n"+
+			"which are only the nightly tests uploaded by run-nightly.sh)")
+	webCmd.Flags().BoolVar(
+		&webCompare, "compare", false, "compare more than two tests rather than displaying an overview")
+	dumpCmd.Flags().StringVar(
+		&dumpFormat, "format", dumpFormat, `output format ("text", "json", "csv", "markdown" or "benchstat")`)
+	wipeCmd.Flags().BoolVar(
+		&wipeAllTypes, "all", false, "remove the processes and data of every cluster type")
+	checkCmd.Flags().StringVar(
+		&checkBaseline, "baseline", "",
+		"the baseline test directory or directory of previous tests (\"s3\" for the tests uploaded to S3)")
+	checkCmd.Flags().Float64Var(
+		&checkMaxThroughputDrop, "max-throughput-drop", checkMaxThroughputDrop,
+		"the allowed decrease in throughput (percent)")
+	checkCmd.Flags().Float64Var(
+		&checkMaxLatencyIncrease, "max-latency-increase", checkMaxLatencyIncrease,
+		"the allowed increase in latency (percent)")
+	checkCmd.Flags().Float64Var(
+		&checkSigma, "sigma", checkSigma,
+		"the number of baseline standard deviations a regression must exceed")
 	testCmd.PersistentFlags().StringVarP(
 		&binary, "binary", "b", "./cockroach", "the remote cockroach binary used to start a server")
 	testCmd.PersistentFlags().DurationVarP(
 		&duration, "duration", "d", 5*time.Minute, "the duration to run each test")
 	testCmd.PersistentFlags().StringVarP(
-		&concurrency, "concurrency", "c", "1-64", "the concurrency to run each test")
+		&concurrency, "concurrency", "c", "1-64",
+		"the concurrency to run each test, as a comma separated list of [=]<lo>[-<hi>[/<step>|x<factor>]]\n"+
+			"(per node unless prefixed by \"=\", e.g. \"1-64\" or \"=1-1024x2,=1500\")")
+	testCmd.PersistentFlags().DurationVar(
+		&warmup, "warmup", 0,
+		"the warm-up period at the start of each run which is excluded from the results (kv and ycsb tests)")
+	testCmd.PersistentFlags().DurationVar(
+		&ramp, "ramp", 0,
+		"the period before each run over which the concurrency is ramped up in stages, excluded from the results\n"+
+			"(kv and ycsb tests)")
+	testCmd.PersistentFlags().DurationVar(
+		&scrapeInterval, "scrape-interval", scrapeInterval,
+		"the interval at which the metrics of each cockroach node are scraped during the runs (0 disables scraping)")
+	testCmd.PersistentFlags().IntVar(
+		&loadRows, "load-rows", loadRows, "the number of rows inserted by the load phase of the ycsb tests")
+	testCmd.PersistentFlags().StringVar(
+		&reuseMode, "reuse", reuseMode,
+		"how the data is reused between the runs of a kv or ycsb test: \"fresh\" wipes and starts the cluster\n"+
+			"before every run, \"cluster\" reuses the running cluster and \"snapshot\" restores a snapshot of the\n"+
+			"stores taken after the load of the first run")
+	testCmd.PersistentFlags().StringArrayVar(
+		&sweeps, "sweep", nil,
+		"sweep a test parameter as <name>=<values> (e.g. read-percent=0,50,95 or batch=1-100x10),\n"+
+			"running each combination of the swept parameters as a separate run")
+	testCmd.PersistentFlags().IntVar(
+		&repeat, "repeat", 1, "the number of times to run each concurrency")
+	testCmd.PersistentFlags().DurationVar(
+		&sloP99, "slo-p99", 0,
+		"search the --concurrency range for the maximum throughput with a p99 latency at most this target")
+	testCmd.PersistentFlags().StringArrayVar(
+		&chaosSpecs, "chaos", nil,
+		"inject a fault during the load of each run as \"<at> <kind> [<option>=<value>...]\", where <kind> is one of\n"+
+			"\"kill node=<nodes> [restart=<duration>]\", \"partition a=<nodes> [b=<nodes>] [for=<duration>]\",\n"+
+			"\"netem node=<nodes> [delay=<duration>] [jitter=<duration>] [loss=<percent>] [for=<duration>]\"\n"+
+			"or \"stall node=<nodes> [for=<duration>]\" (e.g. \"2m kill node=3 restart=30s\")")
+	testCmd.PersistentFlags().StringVar(
+		&putBinDir, "put-bin", "", "upload the cockroach binary in the specified directory before running the test")
+	testCmd.PersistentFlags().BoolVar(
+		&useHAProxy, "haproxy", false, "direct load through haproxy on the load generator node")
 
 	args := os.Args[1:]
 	if len(args) > 0 {
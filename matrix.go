@@ -0,0 +1,465 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// matrixDir is the directory holding the output of a matrix. It defaults to the
+// name of the spec file without its extension.
+var matrixDir string
+
+// matrixParallel runs the tests on different clusters in parallel.
+var matrixParallel bool
+
+// matrixSpec describes a matrix of tests. Every workload is run against every
+// binary on every cluster configuration. For example:
+//
+//	binaries: [./cockroach-v1.1, ./cockroach-v2.0]
+//	workloads: [kv_0, kv_95]
+//	clusters:
+//	- cluster: denim
+//	- name: denim-nocache
+//	  cluster: denim
+//	  args: [--cache=0]
+//	duration: 5m
+//	concurrency: 1-64
+type matrixSpec struct {
+	// Binaries are local cockroach binaries which are uploaded to the cluster
+	// before running the workloads. If there are none, the binary already on
+	// the cluster is used. Binaries are ignored by non-cockroach clusters.
+	Binaries  []string        `yaml:"binaries"`
+	Workloads []string        `yaml:"workloads"`
+	Clusters  []matrixCluster `yaml:"clusters"`
+
+	Duration    time.Duration `yaml:"duration"`
+	Warmup      time.Duration `yaml:"warmup"`
+	Ramp        time.Duration `yaml:"ramp"`
+	Reuse       string        `yaml:"reuse"`
+	Concurrency string        `yaml:"concurrency"`
+	Repeat      int           `yaml:"repeat"`
+	Sweeps      []string      `yaml:"sweeps"`
+	SLOP99      time.Duration `yaml:"slo-p99"`
+	Chaos       []string      `yaml:"chaos"`
+}
+
+// matrixCluster is a cluster configuration. The same cluster may appear in
+// several configurations with different settings.
+type matrixCluster struct {
+	// Name identifies the configuration and defaults to the cluster name.
+	Name    string   `yaml:"name"`
+	Cluster string   `yaml:"cluster"`
+	Type    string   `yaml:"type"`
+	Args    []string `yaml:"args"`
+	Env     string   `yaml:"env"`
+	HAProxy bool     `yaml:"haproxy"`
+}
+
+// matrixEntry is a single test of a matrix.
+type matrixEntry struct {
+	config   matrixCluster
+	workload string
+	binary   string
+	// workDir is the directory in which the test is run. Tests against the
+	// same binary and cluster configuration share a work directory.
+	workDir string
+}
+
+func (e *matrixEntry) key() string {
+	return filepath.Join(filepath.Base(e.workDir), e.workload)
+}
+
+// matrixStatus records the outcome of a test of a matrix, keyed by the entry
+// key. Completed tests are skipped when the matrix is resumed.
+type matrixStatus struct {
+	Done  bool
+	Dir   string `json:",omitempty"`
+	Error string `json:",omitempty"`
+}
+
+func loadMatrixSpec(path string) (*matrixSpec, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	spec := &matrixSpec{}
+	if err := yaml.UnmarshalStrict(data, spec); err != nil {
+		return nil, errors.Wrap(err, path)
+	}
+	if len(spec.Workloads) == 0 {
+		return nil, fmt.Errorf("%s: no workloads specified", path)
+	}
+	if len(spec.Clusters) == 0 {
+		return nil, fmt.Errorf("%s: no clusters specified", path)
+	}
+	for _, w := range spec.Workloads {
+		if _, ok := tests[w]; !ok {
+			return nil, fmt.Errorf("%s: unknown workload: %s", path, w)
+		}
+	}
+	names := map[string]bool{}
+	for i := range spec.Clusters {
+		c := &spec.Clusters[i]
+		if _, ok := clusters[c.Cluster]; !ok {
+			return nil, fmt.Errorf("%s: unknown cluster: %q", path, c.Cluster)
+		}
+		if c.Name == "" {
+			c.Name = c.Cluster
+		}
+		if names[c.Name] {
+			return nil, fmt.Errorf("%s: duplicate cluster configuration: %s", path, c.Name)
+		}
+		names[c.Name] = true
+	}
+	for _, b := range spec.Binaries {
+		if _, err := os.Stat(b); err != nil {
+			return nil, err
+		}
+	}
+	if spec.Concurrency != "" {
+		if _, err := parseConcurrency(spec.Concurrency, 1); err != nil {
+			return nil, errors.Wrap(err, path)
+		}
+	}
+	if _, err := sweepCombinations(spec.Sweeps); err != nil {
+		return nil, errors.Wrap(err, path)
+	}
+	if _, err := parseChaosSpecs(spec.Chaos); err != nil {
+		return nil, errors.Wrap(err, path)
+	}
+	return spec, nil
+}
+
+// entries returns the tests of the matrix in the order of the spec.
+func (s *matrixSpec) entries(dir string) ([]*matrixEntry, error) {
+	var entries []*matrixEntry
+	for _, c := range s.Clusters {
+		binaries := s.Binaries
+		if len(binaries) == 0 || (c.Type != "" && c.Type != "cockroach") {
+			binaries = []string{""}
+		}
+		for i, b := range binaries {
+			workDir := filepath.Join(dir, c.Name)
+			if b != "" {
+				workDir = fmt.Sprintf("%s.%d", workDir, i+1)
+				abs, err := filepath.Abs(b)
+				if err != nil {
+					return nil, err
+				}
+				b = abs
+			}
+			for _, w := range s.Workloads {
+				entries = append(entries, &matrixEntry{
+					config:   c,
+					workload: w,
+					binary:   b,
+					workDir:  workDir,
+				})
+			}
+		}
+	}
+	return entries, nil
+}
+
+// args returns the arguments of the roachperf invocation running the test. The
+// test is resumed if testDir is specified.
+func (s *matrixSpec) args(e *matrixEntry, testDir string) []string {
+	args := []string{e.config.Cluster, "test"}
+	if testDir != "" {
+		args = append(args, testDir)
+	} else {
+		args = append(args, e.workload)
+	}
+	// The binary is uploaded when resuming too, as the cluster may have run the
+	// tests of another binary since. The resumed test verifies that the
+	// uploaded binary is the one it was started with.
+	if e.binary != "" {
+		args = append(args, "--put-bin=.")
+	}
+	if e.config.Type != "" {
+		args = append(args, "--type="+e.config.Type)
+	}
+	for _, a := range e.config.Args {
+		args = append(args, "--args="+a)
+	}
+	if e.config.Env != "" {
+		args = append(args, "--env="+e.config.Env)
+	}
+	if e.config.HAProxy {
+		args = append(args, "--haproxy")
+	}
+	if s.Duration != 0 {
+		args = append(args, "--duration="+s.Duration.String())
+	}
+	if s.Warmup != 0 {
+		args = append(args, "--warmup="+s.Warmup.String())
+	}
+	if s.Ramp != 0 {
+		args = append(args, "--ramp="+s.Ramp.String())
+	}
+	if s.Reuse != "" {
+		args = append(args, "--reuse="+s.Reuse)
+	}
+	if s.Concurrency != "" {
+		args = append(args, "--concurrency="+s.Concurrency)
+	}
+	if s.Repeat != 0 {
+		args = append(args, fmt.Sprintf("--repeat=%d", s.Repeat))
+	}
+	for _, sw := range s.Sweeps {
+		args = append(args, "--sweep="+sw)
+	}
+	if s.SLOP99 != 0 {
+		args = append(args, "--slo-p99="+s.SLOP99.String())
+	}
+	for _, c := range s.Chaos {
+		args = append(args, "--chaos="+c)
+	}
+	return args
+}
+
+// findMatrixTestDir returns the output directory of the workload in the work
+// directory, or "" if the workload has not been started.
+func findMatrixTestDir(workDir, workload string) string {
+	ents, err := ioutil.ReadDir(workDir)
+	if err != nil {
+		return ""
+	}
+	for _, e := range ents {
+		if !e.IsDir() {
+			continue
+		}
+		m := dirRE.FindStringSubmatch(e.Name())
+		if len(m) != 2 || m[1] != workload {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(workDir, e.Name(), "metadata")); err == nil {
+			return e.Name()
+		}
+	}
+	return ""
+}
+
+// runMatrixEntry runs a single test of the matrix in a separate roachperf
+// process, as the test configuration is global. The output of the process is
+// written to <workload>.log in the work directory.
+func runMatrixEntry(spec *matrixSpec, e *matrixEntry, out io.Writer) (string, error) {
+	if err := os.MkdirAll(e.workDir, 0755); err != nil {
+		return "", err
+	}
+	if e.binary != "" {
+		// The binary is staged as ./cockroach in the work directory and
+		// uploaded by the test using putBin.
+		bin := filepath.Join(e.workDir, "cockroach")
+		if _, err := os.Lstat(bin); os.IsNotExist(err) {
+			if err := os.Symlink(e.binary, bin); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	logFile, err := os.OpenFile(filepath.Join(e.workDir, e.workload+".log"),
+		os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return "", err
+	}
+	defer logFile.Close()
+
+	testDir := findMatrixTestDir(e.workDir, e.workload)
+	cmd := exec.Command(self, spec.args(e, testDir)...)
+	cmd.Dir = e.workDir
+	cmd.Stdout = io.MultiWriter(logFile, out)
+	cmd.Stderr = cmd.Stdout
+	fmt.Fprintf(out, "%s: roachperf %s\n", e.key(), strings.Join(cmd.Args[1:], " "))
+	err = cmd.Run()
+
+	if testDir == "" {
+		testDir = findMatrixTestDir(e.workDir, e.workload)
+	}
+	if testDir != "" {
+		testDir = filepath.Join(e.workDir, testDir)
+	}
+	if err != nil {
+		return testDir, errors.Wrap(err, e.key())
+	}
+	if testDir == "" {
+		return "", fmt.Errorf("%s: no test output found", e.key())
+	}
+	return testDir, nil
+}
+
+// matrix runs each test of the matrix which has not already completed and then
+// reports the results of the matrix. Tests on different clusters are run in
+// parallel if requested.
+func matrix(specPath string) error {
+	spec, err := loadMatrixSpec(specPath)
+	if err != nil {
+		return err
+	}
+	dir := matrixDir
+	if dir == "" {
+		dir = strings.TrimSuffix(specPath, filepath.Ext(specPath))
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	entries, err := spec.entries(dir)
+	if err != nil {
+		return err
+	}
+	// Tests on the same cluster run sequentially.
+	byCluster := map[string][]*matrixEntry{}
+	for _, e := range entries {
+		byCluster[e.config.Cluster] = append(byCluster[e.config.Cluster], e)
+	}
+
+	statusPath := filepath.Join(dir, "status")
+	status := map[string]*matrixStatus{}
+	if err := loadJSON(statusPath, &status); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var mu sync.Mutex
+	update := func(e *matrixEntry, testDir string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		s := &matrixStatus{Done: err == nil, Dir: testDir}
+		if err != nil {
+			s.Error = err.Error()
+		}
+		status[e.key()] = s
+		saveJSON(statusPath, status)
+	}
+
+	runCluster := func(entries []*matrixEntry, out io.Writer) {
+		for _, e := range entries {
+			mu.Lock()
+			s := status[e.key()]
+			mu.Unlock()
+			if s != nil && s.Done {
+				continue
+			}
+			testDir, err := runMatrixEntry(spec, e, out)
+			if err != nil {
+				fmt.Fprintf(out, "%s\n", err)
+			}
+			update(e, testDir, err)
+		}
+	}
+
+	var names []string
+	for name := range byCluster {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if matrixParallel {
+		// The output of each test is only written to its log file as the output
+		// of the clusters would otherwise be interleaved.
+		var wg sync.WaitGroup
+		for _, name := range names {
+			wg.Add(1)
+			go func(entries []*matrixEntry) {
+				defer wg.Done()
+				runCluster(entries, ioutil.Discard)
+			}(byCluster[name])
+		}
+		wg.Wait()
+	} else {
+		for _, name := range names {
+			runCluster(byCluster[name], os.Stdout)
+		}
+	}
+
+	return matrixReport(dir, entries, status)
+}
+
+// matrixReport prints the peak throughput of each test of the matrix and
+// writes an overview of the tests to report.html in the matrix directory.
+func matrixReport(dir string, entries []*matrixEntry, status map[string]*matrixStatus) error {
+	entries = append([]*matrixEntry(nil), entries...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].workload < entries[j].workload
+	})
+
+	tw := tabwriter.NewWriter(os.Stdout, 2, 1, 2, ' ', 0)
+	fmt.Fprintf(tw, "workload\tcluster\tbin\tpeak ops/sec\tconcurrency\tp99(ms)\tstatus\n")
+	var dirs []string
+	var failed int
+	for _, e := range entries {
+		s := status[e.key()]
+		state := "done"
+		switch {
+		case s == nil:
+			state = "not run"
+			failed++
+		case !s.Done:
+			state = "failed"
+			failed++
+		}
+		bin, peak := "-", "-"
+		conc, p99 := "-", "-"
+		if s != nil && s.Dir != "" {
+			d, err := loadTestData(s.Dir)
+			if err != nil {
+				return err
+			}
+			bin = d.Metadata.Bin
+			if r := peakRun(d); r != nil {
+				peak = fmt.Sprintf("%.1f", r.OpsSec)
+				conc = r.key()
+				p99 = fmt.Sprintf("%.1f", r.P99Lat)
+			}
+			if len(d.Runs) > 0 {
+				dirs = append(dirs, s.Dir)
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			e.workload, filepath.Base(e.workDir), bin, peak, conc, p99, state)
+	}
+	_ = tw.Flush()
+
+	if len(dirs) > 0 {
+		f, err := os.Create(filepath.Join(dir, "report.html"))
+		if err != nil {
+			return err
+		}
+		if err := webBulk(f, dirs); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		fmt.Printf("report: %s\n", f.Name())
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d test(s) did not complete", failed, len(entries))
+	}
+	return nil
+}
+
+// peakRun returns the run with the highest throughput.
+func peakRun(d *testData) *testRun {
+	var peak *testRun
+	for _, r := range d.Runs {
+		if peak == nil || r.OpsSec > peak.OpsSec {
+			peak = r
+		}
+	}
+	return peak
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// scrapeInterval is the interval at which the metrics of each node are scraped
+// during a run. Zero disables scraping.
+var scrapeInterval = 10 * time.Second
+
+// nodeMetric is a key metric of the nodes, summarized for each run from the
+// variables exported by /_status/vars. The variables are summed across their
+// labels (e.g. stores).
+type nodeMetric struct {
+	name string
+	vars []string
+	// counter metrics report the increase during the run rather than the mean.
+	counter bool
+	// perNode metrics are averaged across the nodes rather than summed.
+	perNode bool
+	scale   float64
+}
+
+var nodeMetrics = []nodeMetric{
+	{"cpu(%)", []string{"sys_cpu_user_percent", "sys_cpu_sys_percent"}, false, true, 100},
+	{"ranges", []string{"ranges"}, false, false, 1},
+	{"leaders", []string{"replicas_leaders"}, false, false, 1},
+	{"raft(s)", []string{"raft_process_workingnanos"}, true, false, 1e-9},
+	{"splits", []string{"range_splits"}, true, false, 1},
+	{"rebalances", []string{"queue_replicate_rebalancereplica"}, true, false, 1},
+	{"compactions", []string{"rocksdb_compactions"}, true, false, 1},
+}
+
+// metricSample is a scrape of the variables of a node. The samples of a run
+// are stored one per line as JSON in <dir>/<run>.metrics.
+type metricSample struct {
+	// Elapsed is the time since the start of the load (in seconds).
+	Elapsed float64
+	Node    int
+	Vars    map[string]float64
+}
+
+func metricsPath(dir, run string) string {
+	return filepath.Join(dir, run+".metrics")
+}
+
+// scrapedVars returns the variables used by the key metrics.
+func scrapedVars() map[string]bool {
+	vars := map[string]bool{}
+	for _, m := range nodeMetrics {
+		for _, v := range m.vars {
+			vars[v] = true
+		}
+	}
+	return vars
+}
+
+// parseVars parses the Prometheus text format, returning the sum of the
+// samples of each of the requested variables.
+func parseVars(data string, want map[string]bool) map[string]float64 {
+	vars := map[string]float64{}
+	for _, line := range strings.Split(data, "\n") {
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		name := line
+		if i := strings.IndexAny(line, "{ "); i != -1 {
+			name = line[:i]
+		}
+		if !want[name] {
+			continue
+		}
+		fields := strings.Fields(line)
+		v, err := strconv.ParseFloat(fields[len(fields)-1], 64)
+		if err != nil {
+			continue
+		}
+		vars[name] += v
+	}
+	return vars
+}
+
+// startScrape scrapes the metrics of the server nodes of a cockroach cluster
+// every scrapeInterval until the returned function is called. Nodes which
+// cannot be scraped, such as those killed during the run, are skipped. A scrape
+// times out after scrapeInterval and a node is not scraped again while its
+// previous scrape is in flight (e.g. when its host is unresponsive). Stopping
+// does not wait for the scrapes in flight, whose samples are discarded.
+func startScrape(c *cluster, dir, run string) (stop func()) {
+	if clusterType != "cockroach" || scrapeInterval <= 0 {
+		return func() {}
+	}
+	f, err := os.Create(metricsPath(dir, run))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to record metrics: %s\n", err)
+		return func() {}
+	}
+
+	want := scrapedVars()
+	start := time.Now()
+	// mu protects f, closed and inFlight.
+	var mu sync.Mutex
+	var closed bool
+	inFlight := map[int]bool{}
+	scrape := func(n int) {
+		defer func() {
+			mu.Lock()
+			delete(inFlight, n)
+			mu.Unlock()
+		}()
+		session, err := newSSHSession(c.user(n), c.host(n))
+		if err != nil {
+			return
+		}
+		defer session.Close()
+
+		url := fmt.Sprintf("http://localhost:%d/_status/vars", cockroach{}.nodePort(c, n)+1)
+		if c.secure {
+			url = "-k https" + strings.TrimPrefix(url, "http")
+		}
+		out, err := session.Output(fmt.Sprintf("curl -s -m %g %s", scrapeInterval.Seconds(), url))
+		if err != nil {
+			return
+		}
+		s := metricSample{
+			Elapsed: time.Since(start).Seconds(),
+			Node:    n,
+			Vars:    parseVars(string(out), want),
+		}
+		data, err := json.Marshal(s)
+		if err != nil {
+			return
+		}
+		mu.Lock()
+		if !closed {
+			_, _ = f.Write(append(data, '\n'))
+		}
+		mu.Unlock()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		t := time.NewTicker(scrapeInterval)
+		defer t.Stop()
+		for {
+			mu.Lock()
+			for _, n := range c.serverNodes() {
+				if !inFlight[n] {
+					inFlight[n] = true
+					go scrape(n)
+				}
+			}
+			mu.Unlock()
+			select {
+			case <-t.C:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		mu.Lock()
+		closed = true
+		f.Close()
+		mu.Unlock()
+	}
+}
+
+// loadRunMetrics returns the metric samples of a run. A run without metrics
+// has no samples.
+func loadRunMetrics(dir, run string) ([]metricSample, error) {
+	f, err := os.Open(metricsPath(dir, run))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var samples []metricSample
+	s := bufio.NewScanner(f)
+	s.Buffer(nil, 1<<20)
+	for s.Scan() {
+		var m metricSample
+		if err := json.Unmarshal(s.Bytes(), &m); err != nil {
+			return nil, err
+		}
+		samples = append(samples, m)
+	}
+	return samples, s.Err()
+}
+
+// summarizeMetrics returns the key metrics of a run from the samples after
+// start (in seconds). Gauges are averaged over the samples of each node and
+// counters report their increase since the last sample before start,
+// accounting for nodes which restarted during the run.
+func summarizeMetrics(samples []metricSample, start float64) map[string]float64 {
+	byNode := map[int][]metricSample{}
+	for _, s := range samples {
+		byNode[s.Node] = append(byNode[s.Node], s)
+	}
+	for _, ss := range byNode {
+		sort.Slice(ss, func(i, j int) bool { return ss[i].Elapsed < ss[j].Elapsed })
+	}
+
+	summary := map[string]float64{}
+	for _, m := range nodeMetrics {
+		var total float64
+		var nodes int
+		for _, ss := range byNode {
+			v, ok := summarizeNode(m, ss, start)
+			if ok {
+				total += v
+				nodes++
+			}
+		}
+		if nodes == 0 {
+			continue
+		}
+		if m.perNode {
+			total /= float64(nodes)
+		}
+		summary[m.name] = total * m.scale
+	}
+	return summary
+}
+
+func summarizeNode(m nodeMetric, samples []metricSample, start float64) (float64, bool) {
+	value := func(s metricSample) (float64, bool) {
+		var sum float64
+		var found bool
+		for _, v := range m.vars {
+			if x, ok := s.Vars[v]; ok {
+				sum += x
+				found = true
+			}
+		}
+		return sum, found
+	}
+
+	var prev *float64
+	var total float64
+	var n int
+	for _, s := range samples {
+		v, ok := value(s)
+		if !ok {
+			continue
+		}
+		if s.Elapsed <= start && start > 0 {
+			if m.counter {
+				prev = &v
+			}
+			continue
+		}
+		switch {
+		case !m.counter:
+			total += v
+		case prev == nil:
+		case v >= *prev:
+			total += v - *prev
+		default:
+			// The counter was reset by a restart of the node.
+			total += v
+		}
+		prev = &v
+		n++
+	}
+	if n == 0 {
+		return 0, false
+	}
+	if !m.counter {
+		total /= float64(n)
+	}
+	return total, true
+}
+
+// metricsHeader returns the names of the key metrics recorded by any of the
+// runs.
+func metricsHeader(runs []*testRun) []string {
+	var names []string
+	for _, m := range nodeMetrics {
+		for _, r := range runs {
+			if _, ok := r.Metrics[m.name]; ok {
+				names = append(names, m.name)
+				break
+			}
+		}
+	}
+	return names
+}
+
+// compareNodeMetrics returns the key metrics recorded by any of the runs of
+// the tests as metrics to compare. A run which did not record a metric has no
+// value for it.
+func compareNodeMetrics(ds []*testData) []metric {
+	var ms []metric
+	for _, name := range metricsHeader(allRuns(ds)) {
+		name := name
+		ms = append(ms, metric{name, func(r *testRun) float64 {
+			if v, ok := r.Metrics[name]; ok {
+				return v
+			}
+			return math.NaN()
+		}, false})
+	}
+	return ms
+}
+
+// metricsRecord returns the key metrics of a run in the order of names.
+func metricsRecord(r *testRun, names []string) []string {
+	record := make([]string, len(names))
+	for i, name := range names {
+		record[i] = "-"
+		if v, ok := r.Metrics[name]; ok {
+			record[i] = fmt.Sprintf("%.1f", v)
+		}
+	}
+	return record
+}
+
+// runScrapedLoad runs the load of a run while injecting the faults specified by
+// --chaos and scraping the metrics of the nodes into <run>.metrics.
+func runScrapedLoad(
+	c *cluster, dir, run string, events *eventLog, cmd string, stdout, stderr io.Writer,
+) error {
+	stop := startScrape(c, dir, run)
+	defer stop()
+	return runChaosLoad(c, events, cmd, stdout, stderr)
+}
+
+// meanMetrics returns the mean of the key metrics of the repetitions of a run
+// which recorded them.
+func meanMetrics(samples []*testRun) map[string]float64 {
+	var mean map[string]float64
+	counts := map[string]int{}
+	for _, s := range samples {
+		for name, v := range s.Metrics {
+			if mean == nil {
+				mean = map[string]float64{}
+			}
+			mean[name] += v
+			counts[name]++
+		}
+	}
+	for name, n := range counts {
+		mean[name] /= float64(n)
+	}
+	return mean
+}
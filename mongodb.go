@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const mongoReplSet = "rs0"
+
+type mongodb struct{}
+
+// start starts mongod on each of the server nodes and initiates a replica set
+// containing all of them. The first server node is given a higher priority so
+// that it is elected primary.
+func (r mongodb) start(c *cluster) {
+	nodes := c.serverNodes()
+
+	display := fmt.Sprintf("%s: starting mongodb", c.name)
+	c.parallel(display, len(nodes), 0, func(i int) ([]byte, error) {
+		session, err := newSSHSession(c.user(nodes[i]), c.host(nodes[i]))
+		if err != nil {
+			return nil, err
+		}
+		defer session.Close()
+
+		bind := "--bind_ip_all"
+		if c.isLocal() {
+			bind = "--bind_ip localhost"
+		}
+		dir := r.dataDir(c, nodes[i])
+		cmd := fmt.Sprintf("mkdir -p %[1]s && %[2]s mongod --replSet %[3]s %[4]s --port %[5]d "+
+			"--dbpath %[1]s --fork --logpath %[1]s/mongod.log > /dev/null",
+			dir, c.env, mongoReplSet, bind, r.nodePort(c, nodes[i]))
+		return session.CombinedOutput(cmd)
+	})
+
+	display = fmt.Sprintf("%s: retrieving IP addresses", c.name)
+	ips := make([]string, len(nodes))
+	c.parallel(display, len(nodes), 0, func(i int) ([]byte, error) {
+		var err error
+		ips[i], err = c.getInternalIP(nodes[i])
+		return nil, err
+	})
+
+	var members []string
+	for i, ip := range ips {
+		priority := 1
+		if i == 0 {
+			priority = 2
+		}
+		members = append(members, fmt.Sprintf(`{_id: %d, host: "%s:%d", priority: %d}`,
+			i, ip, r.nodePort(c, nodes[i]), priority))
+	}
+
+	display = fmt.Sprintf("%s: initiating replica set", c.name)
+	c.parallel(display, 1, 0, func(i int) ([]byte, error) {
+		session, err := newSSHSession(c.user(nodes[0]), c.host(nodes[0]))
+		if err != nil {
+			return nil, err
+		}
+		defer session.Close()
+
+		// The replica set is only initiated if it doesn't exist already (i.e.
+		// the cluster was not wiped before being started). We then wait for a
+		// primary to be elected so that the cluster is ready to accept writes.
+		port := r.nodePort(c, nodes[0])
+		cmd := fmt.Sprintf(`
+mongo --port %[1]d --quiet --eval '
+if (rs.status().ok === 0) {
+  var res = rs.initiate({_id: "%[2]s", members: [%[3]s]});
+  if (res.ok !== 1) { printjson(res); quit(1); }
+}' &&
+for i in $(seq 1 60); do
+  if [ -n "$(mongo --port %[1]d --quiet --eval 'print(db.isMaster().primary || "")')" ]; then
+    exit 0
+  fi
+  sleep 1
+done
+echo "timed out waiting for primary"
+exit 1
+`, port, mongoReplSet, strings.Join(members, ", "))
+		return session.CombinedOutput(cmd)
+	})
+}
+
+func (r mongodb) stop(c *cluster) {
+	display := fmt.Sprintf("%s: stopping", c.name)
+	c.stopNodes(display, func(index int) string {
+		return r.killCmd(c, index)
+	})
+}
+
+func (r mongodb) wipe(c *cluster) {
+	display := fmt.Sprintf("%s: wiping", c.name)
+	c.stopNodes(display, func(index int) string {
+		return r.killCmd(c, index) + "rm -fr " + r.dataDir(c, index) + " ;\n"
+	})
+}
+
+func (r mongodb) killCmd(c *cluster, index int) string {
+	return fmt.Sprintf(`mongod --dbpath %s --shutdown > /dev/null 2>&1 ;
+kill -9 $(lsof -t -i :%d) 2>/dev/null || true ;
+`, r.dataDir(c, index), r.nodePort(c, index))
+}
+
+// status displays the replica set member state of each node.
+func (r mongodb) status(c *cluster) {
+	c.printStatus(func(index int) string {
+		return fmt.Sprintf(`out=$(mongo --port %d --quiet --eval '
+var s = rs.status();
+var self = s.members ? s.members.filter(function(m) { return m.self; })[0] : null;
+print("mongod " + (self ? self.stateStr : "NOT-INITIATED"));' 2>/dev/null) && echo "${out}"
+true
+`, r.nodePort(c, index))
+	})
+}
+
+func (mongodb) dataDir(c *cluster, index int) string {
+	if c.isLocal() {
+		return fmt.Sprintf("${HOME}/local/mongo%d", index)
+	}
+	return "/mnt/data1/mongo-data"
+}
+
+func (mongodb) nodeURL(_ *cluster, host string, port int) string {
+	return fmt.Sprintf("'mongodb://%s:%d'", host, port)
+}
+
+func (mongodb) nodePort(c *cluster, index int) int {
+	const basePort = 27017
+	port := basePort
+	if c.isLocal() {
+		port += index - 1
+	}
+	return port
+}
+
+func (mongodb) loadNodes(c *cluster) []int {
+	return c.serverNodes()
+}
+
+func (mongodb) restartCmd(c *cluster, index int) (string, error) {
+	return "", fmt.Errorf("restarting mongodb nodes is not supported")
+}
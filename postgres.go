@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+var postgresReplicas = false
+
+type postgres struct{}
+
+// start starts a postgres primary on the first server node. If
+// postgresReplicas is set, the remaining server nodes are started as
+// synchronous streaming replicas of the primary.
+func (r postgres) start(c *cluster) {
+	nodes := c.serverNodes()
+	primary := nodes[0]
+	primaryIP, err := c.getInternalIP(primary)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	display := fmt.Sprintf("%s: starting postgres primary", c.name)
+	c.parallel(display, 1, 0, func(i int) ([]byte, error) {
+		session, err := newSSHSession(c.user(primary), c.host(primary))
+		if err != nil {
+			return nil, err
+		}
+		defer session.Close()
+
+		port := r.nodePort(c, primary)
+		// Replication is synchronous so that commits are durable on multiple
+		// nodes, mirroring cockroach. This is enabled after the test database
+		// is created as that would otherwise block waiting for the replicas.
+		var sync string
+		if postgresReplicas && len(nodes) > 1 {
+			sync = fmt.Sprintf(` &&
+  psql -p %d -d postgres -c "ALTER SYSTEM SET synchronous_standby_names = '*'" \
+    -c "SELECT pg_reload_conf()" > /dev/null`, port)
+		}
+		cmd := postgresPath + fmt.Sprintf(`
+if [ ! -f %[1]s/PG_VERSION ]; then
+  mkdir -p %[1]s &&
+  initdb -D %[1]s -U root --auth=trust > /dev/null &&
+  cat >> %[1]s/postgresql.conf <<EOF
+listen_addresses = '*'
+port = %[2]d
+max_connections = 1000
+wal_level = replica
+max_wal_senders = 10
+hot_standby = on
+EOF
+  echo "host all all 0.0.0.0/0 trust" >> %[1]s/pg_hba.conf &&
+  echo "host replication all 0.0.0.0/0 trust" >> %[1]s/pg_hba.conf &&
+  %[4]s pg_ctl -D %[1]s -l %[1]s/postgres.log -w start > /dev/null &&
+  psql -p %[2]d -d postgres -c 'CREATE DATABASE test' > /dev/null%[3]s
+else
+  %[4]s pg_ctl -D %[1]s -l %[1]s/postgres.log -w start > /dev/null
+fi
+`, r.dataDir(c, primary), port, sync, c.env)
+		return session.CombinedOutput(cmd)
+	})
+
+	if !postgresReplicas || len(nodes) == 1 {
+		return
+	}
+
+	replicas := nodes[1:]
+	display = fmt.Sprintf("%s: starting postgres replicas", c.name)
+	c.parallel(display, len(replicas), 0, func(i int) ([]byte, error) {
+		session, err := newSSHSession(c.user(replicas[i]), c.host(replicas[i]))
+		if err != nil {
+			return nil, err
+		}
+		defer session.Close()
+
+		dir := r.dataDir(c, replicas[i])
+		// pg_basebackup copies the primary's postgresql.conf. Appending the port
+		// overrides the primary's setting.
+		cmd := postgresPath + fmt.Sprintf(`
+if [ ! -f %[1]s/PG_VERSION ]; then
+  mkdir -p $(dirname %[1]s) &&
+  pg_basebackup -h %[2]s -p %[3]d -U root -D %[1]s -X stream -R &&
+  echo "port = %[4]d" >> %[1]s/postgresql.conf
+fi &&
+%[5]s pg_ctl -D %[1]s -l %[1]s/postgres.log -w start > /dev/null
+`, dir, primaryIP, r.nodePort(c, primary), r.nodePort(c, replicas[i]), c.env)
+		return session.CombinedOutput(cmd)
+	})
+}
+
+func (r postgres) stop(c *cluster) {
+	display := fmt.Sprintf("%s: stopping", c.name)
+	c.stopNodes(display, func(index int) string {
+		return r.killCmd(c, index)
+	})
+}
+
+func (r postgres) wipe(c *cluster) {
+	display := fmt.Sprintf("%s: wiping", c.name)
+	c.stopNodes(display, func(index int) string {
+		return r.killCmd(c, index) + "rm -fr " + r.dataDir(c, index) + " ;\n"
+	})
+}
+
+func (r postgres) killCmd(c *cluster, index int) string {
+	return postgresPath + fmt.Sprintf(`
+pg_ctl -D %s -m fast stop > /dev/null 2>&1 ;
+kill -9 $(lsof -t -i :%d) 2>/dev/null || true ;
+`, r.dataDir(c, index), r.nodePort(c, index))
+}
+
+// status displays whether each node is the primary or a replica.
+func (r postgres) status(c *cluster) {
+	c.printStatus(func(index int) string {
+		return postgresPath + fmt.Sprintf(`
+psql -p %d -d postgres -tAc \
+  "SELECT 'postgres ' || CASE WHEN pg_is_in_recovery() THEN 'replica' ELSE 'primary' END" 2>/dev/null
+true
+`, r.nodePort(c, index))
+	})
+}
+
+// postgresPath adds the postgres binaries installed by the postgresql package
+// to the PATH.
+const postgresPath = `export PATH=$(ls -d /usr/lib/postgresql/*/bin 2>/dev/null | sort -V | tail -1):${PATH};`
+
+func (postgres) dataDir(c *cluster, index int) string {
+	if c.isLocal() {
+		return fmt.Sprintf("${HOME}/local/postgres%d", index)
+	}
+	return "/mnt/data1/postgres"
+}
+
+func (postgres) nodeURL(_ *cluster, host string, port int) string {
+	return fmt.Sprintf("'postgres://root@%s:%d/test?sslmode=disable'", host, port)
+}
+
+func (postgres) nodePort(c *cluster, index int) int {
+	const basePort = 5432
+	port := basePort
+	if c.isLocal() {
+		port += index - 1
+	}
+	return port
+}
+
+// loadNodes returns the primary, as the replicas are read-only.
+func (postgres) loadNodes(c *cluster) []int {
+	return c.serverNodes()[:1]
+}
+
+func (postgres) restartCmd(c *cluster, index int) (string, error) {
+	return "", fmt.Errorf("restarting postgres nodes is not supported")
+}
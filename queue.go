@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// queueDir is the directory holding the test queue. Each queued test has a
+// directory named by its ID containing its state (job), the output of the test
+// process (log) and the test output directory.
+var queueDir = "${HOME}/.roachperf/queue"
+
+// The states of a queued test.
+const (
+	jobQueued  = "queued"
+	jobRunning = "running"
+	jobDone    = "done"
+	jobFailed  = "failed"
+)
+
+// queueJob is a test in the queue.
+type queueJob struct {
+	ID      string
+	Cluster string
+	// Args are the test name or test directory followed by the test flags.
+	Args     []string
+	State    string
+	Added    time.Time
+	Started  time.Time
+	Finished time.Time
+	// PID is the process running the test.
+	PID   int    `json:",omitempty"`
+	Error string `json:",omitempty"`
+}
+
+func (j *queueJob) dir() string {
+	return filepath.Join(os.ExpandEnv(queueDir), j.ID)
+}
+
+// test returns the name of the test run by the job.
+func (j *queueJob) test() string {
+	return testDirName(j.Args[0])
+}
+
+// testDir returns the test output directory of the job, or "" if the test has
+// not been started.
+func (j *queueJob) testDir() string {
+	if filepath.IsAbs(j.Args[0]) {
+		return j.Args[0]
+	}
+	if name := findMatrixTestDir(j.dir(), j.test()); name != "" {
+		return filepath.Join(j.dir(), name)
+	}
+	return ""
+}
+
+// save writes the job state. The state is written to a temporary file which is
+// renamed so that readers never observe a partially written state.
+func (j *queueJob) save() error {
+	if err := os.MkdirAll(j.dir(), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(j, "", "\t")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(j.dir(), "job")
+	if err := ioutil.WriteFile(path+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// loadQueue returns the queued tests in the order they were added.
+func loadQueue() ([]*queueJob, error) {
+	dir := os.ExpandEnv(queueDir)
+	ents, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var jobs []*queueJob
+	for _, e := range ents {
+		if !e.IsDir() {
+			continue
+		}
+		j := &queueJob{}
+		if err := loadJSON(filepath.Join(dir, e.Name(), "job"), j); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		jobs = append(jobs, j)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].ID < jobs[j].ID
+	})
+	return jobs, nil
+}
+
+// queueAdd adds a test to the queue of the cluster. A test directory may be
+// specified in order to resume a test.
+func queueAdd(clusterName string, args []string) error {
+	if _, ok := clusters[clusterName]; !ok {
+		return fmt.Errorf("unknown cluster: %s", clusterName)
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("no test specified")
+	}
+	if !isTest(args[0]) {
+		return fmt.Errorf("unknown test: %s", args[0])
+	}
+	if _, ok := tests[args[0]]; !ok {
+		dir, err := filepath.Abs(resolveTestDir(args[0]))
+		if err != nil {
+			return err
+		}
+		args = append([]string{dir}, args[1:]...)
+	}
+
+	now := time.Now()
+	j := &queueJob{
+		ID:      now.UTC().Format("20060102-150405.000000"),
+		Cluster: clusterName,
+		Args:    args,
+		State:   jobQueued,
+		Added:   now,
+	}
+	if err := j.save(); err != nil {
+		return err
+	}
+	fmt.Printf("queued %s: %s test %s\n", j.ID, j.Cluster, strings.Join(j.Args, " "))
+	return nil
+}
+
+func queueList() error {
+	jobs, err := loadQueue()
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "ID\tCLUSTER\tTEST\tSTATE\tADDED\tELAPSED\n")
+	for _, j := range jobs {
+		state := j.State
+		if j.Error != "" {
+			state += ": " + j.Error
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			j.ID, j.Cluster, strings.Join(j.Args, " "), state,
+			j.Added.Format("2006-01-02 15:04:05"), j.elapsed())
+	}
+	return tw.Flush()
+}
+
+// elapsed returns the time the job has been running or ran for.
+func (j *queueJob) elapsed() string {
+	switch {
+	case j.Started.IsZero():
+		return "-"
+	case j.Finished.IsZero():
+		return time.Since(j.Started).Round(time.Second).String()
+	default:
+		return j.Finished.Sub(j.Started).Round(time.Second).String()
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// resultsDir is the directory containing the results index. Each registered
+// test result is described by a <id>.json file which refers to the test
+// directory containing the result.
+var resultsDir = "${HOME}/.roachperf/results"
+
+var resultsFilter struct {
+	test    string
+	cluster string
+	bin     string
+	since   string
+	until   string
+	args    string
+}
+
+var resultsPurge bool
+
+type result struct {
+	ID       string
+	Name     string
+	Dir      string
+	Metadata testMetadata
+}
+
+// resultID returns the ID of the result stored in the specified test
+// directory. The test directory name is not unique as the same test can be
+// run multiple times against the same binary, so the date is included.
+func resultID(dir string, m testMetadata) string {
+	return fmt.Sprintf("%s.%s", filepath.Base(dir), m.Date)
+}
+
+// testDirName returns the name of the test whose output is stored in the
+// specified test directory (e.g. kv_95 for kv_95.cockroach-v2.0).
+func testDirName(dir string) string {
+	dir = resolveTestDir(dir)
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	name := filepath.Base(dir)
+	if m := dirRE.FindStringSubmatch(name); len(m) == 2 {
+		return m[1]
+	}
+	return name
+}
+
+// registerResult adds the test directory to the results index. A failure to
+// register a result is not fatal to the test.
+func registerResult(dir string) {
+	if _, err := importResult(dir); err != nil {
+		fmt.Fprintf(os.Stderr, "unable to register result %s: %s\n", dir, err)
+	}
+}
+
+func importResult(dir string) (*result, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	r := &result{Dir: abs}
+	if err := loadJSON(filepath.Join(abs, "metadata"), &r.Metadata); err != nil {
+		return nil, err
+	}
+	r.ID = resultID(abs, r.Metadata)
+	r.Name = testDirName(abs)
+
+	index := os.ExpandEnv(resultsDir)
+	if err := os.MkdirAll(index, 0755); err != nil {
+		return nil, err
+	}
+	saveJSON(filepath.Join(index, r.ID+".json"), r)
+	return r, nil
+}
+
+func loadResults() ([]*result, error) {
+	index := os.ExpandEnv(resultsDir)
+	ents, err := ioutil.ReadDir(index)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var results []*result
+	for _, e := range ents {
+		if filepath.Ext(e.Name()) != ".json" {
+			continue
+		}
+		r := &result{}
+		if err := loadJSON(filepath.Join(index, e.Name()), r); err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Metadata.Date < results[j].Metadata.Date
+	})
+	return results, nil
+}
+
+func findResult(id string) (*result, error) {
+	r := &result{}
+	path := filepath.Join(os.ExpandEnv(resultsDir), id+".json")
+	if err := loadJSON(path, r); err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("unknown result: %s", id)
+		}
+		return nil, err
+	}
+	return r, nil
+}
+
+// resolveTestDir returns the test directory for the specified argument, which
+// is either a test directory or the ID of a registered result.
+func resolveTestDir(arg string) string {
+	if _, err := os.Stat(arg); err == nil {
+		return arg
+	}
+	if r, err := findResult(arg); err == nil {
+		return r.Dir
+	}
+	return arg
+}
+
+// matches returns true if the result matches the --test, --cluster, --bin,
+// --since, --until and --args filters. Dates are compared as prefixes of the
+// recorded date (e.g. 2018-01-02).
+func (r *result) matches() bool {
+	f := &resultsFilter
+	m := &r.Metadata
+	switch {
+	case f.test != "" && r.Name != f.test:
+		return false
+	case f.cluster != "" && m.Cluster != f.cluster:
+		return false
+	case f.bin != "" && !strings.Contains(m.Bin, f.bin):
+		return false
+	case f.since != "" && m.Date < f.since:
+		return false
+	case f.until != "" && datePrefix(m.Date, f.until) > f.until:
+		return false
+	case f.args != "" && !strings.Contains(strings.Join(m.Args, " "), f.args):
+		return false
+	}
+	return true
+}
+
+// datePrefix truncates date to the length of the date it is being compared to
+// so that, for example, an --until date includes the whole day.
+func datePrefix(date, cmp string) string {
+	if len(date) > len(cmp) {
+		return date[:len(cmp)]
+	}
+	return date
+}
+
+func resultsList() error {
+	results, err := loadResults()
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "ID\tTEST\tCLUSTER\tBIN\tDATE\tRUNS\n")
+	for _, r := range results {
+		if !r.matches() {
+			continue
+		}
+		runs := "-"
+		if d, err := loadTestData(r.Dir); err == nil {
+			runs = fmt.Sprint(len(d.Runs))
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			r.ID, r.Name, r.Metadata.Cluster, r.Metadata.Bin, r.Metadata.Date, runs)
+	}
+	return tw.Flush()
+}
+
+func resultsShow(ids []string) error {
+	if len(ids) == 0 {
+		return fmt.Errorf("no result specified")
+	}
+	for _, id := range ids {
+		r, err := findResult(id)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s\n%s\n", r.Dir, prettyJSON(r.Metadata))
+		d, err := loadTestData(r.Dir)
+		if err != nil {
+			return err
+		}
+		if err := dump1(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func resultsImport(dirs []string) error {
+	if len(dirs) == 0 {
+		return fmt.Errorf("no test directory specified")
+	}
+	for _, dir := range dirs {
+		r, err := importResult(dir)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("imported %s\n", r.ID)
+	}
+	return nil
+}
+
+func resultsDelete(ids []string) error {
+	if len(ids) == 0 {
+		return fmt.Errorf("no result specified")
+	}
+	for _, id := range ids {
+		r, err := findResult(id)
+		if err != nil {
+			return err
+		}
+		if resultsPurge {
+			if err := os.RemoveAll(r.Dir); err != nil {
+				return err
+			}
+		}
+		if err := os.Remove(filepath.Join(os.ExpandEnv(resultsDir), id+".json")); err != nil {
+			return err
+		}
+		fmt.Printf("deleted %s\n", id)
+	}
+	return nil
+}
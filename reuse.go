@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+)
+
+// The data reuse modes of the runs of a test (see --reuse).
+const (
+	// reuseFresh wipes and starts the cluster before every run.
+	reuseFresh = "fresh"
+	// reuseCluster wipes and starts the cluster before the first run and
+	// reuses the running cluster and its data for the subsequent runs.
+	reuseCluster = "cluster"
+	// reuseSnapshot wipes and starts the cluster before the first run and
+	// snapshots the store of each node after the load of the first run. The
+	// subsequent runs restore the snapshot before starting the cluster.
+	reuseSnapshot = "snapshot"
+)
+
+var reuseMode = reuseFresh
+
+func checkReuseMode(mode string) error {
+	switch mode {
+	case reuseFresh, reuseCluster:
+		return nil
+	case reuseSnapshot:
+		if clusterType != "cockroach" {
+			return fmt.Errorf("--reuse=%s is only supported by cockroach clusters", mode)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown reuse mode: %s", mode)
+}
+
+// dataReuse prepares the cluster before each run of a test according to the
+// reuse mode. Snapshots are only restored by the process which took them, so a
+// resumed test never restores a snapshot of another test.
+type dataReuse struct {
+	prepared bool
+	snapshot bool
+}
+
+var runData dataReuse
+
+// prepare readies the cluster for a run, recording the steps in the event log.
+// If the test has a load phase, load is run whenever the cluster is wiped and
+// the data it loads is snapshotted.
+func (d *dataReuse) prepare(c *cluster, events *eventLog, load func() error) error {
+	switch {
+	case reuseMode == reuseCluster && d.prepared:
+		events.record("reuse", "")
+		return restartKilled(c, events)
+	case reuseMode == reuseSnapshot && d.snapshot:
+		events.record("stop", "")
+		c.stop()
+		events.record("restore", "")
+		restoreSnapshot(c)
+		events.record("start", "")
+		c.start()
+		return nil
+	}
+	events.record("wipe", "")
+	c.wipe()
+	events.record("start", "")
+	c.start()
+	if load != nil {
+		if err := load(); err != nil {
+			return err
+		}
+	}
+	d.prepared = true
+	if load != nil && reuseMode == reuseSnapshot {
+		d.takeSnapshot(c, events)
+		events.record("start", "")
+		c.start()
+	}
+	return nil
+}
+
+// loaded is called after the load of a run completes. Without a load phase,
+// the data loaded by the first run is snapshotted.
+func (d *dataReuse) loaded(c *cluster, events *eventLog) {
+	if reuseMode != reuseSnapshot || d.snapshot {
+		return
+	}
+	d.takeSnapshot(c, events)
+}
+
+func (d *dataReuse) takeSnapshot(c *cluster, events *eventLog) {
+	events.record("stop", "")
+	c.stop()
+	events.record("snapshot", "")
+	takeSnapshot(c)
+	d.snapshot = true
+}
+
+// cleanup removes the snapshots taken by the test, if any.
+func (d *dataReuse) cleanup(c *cluster) {
+	if !d.snapshot {
+		return
+	}
+	r := cockroach{}
+	display := fmt.Sprintf("%s: removing snapshots", c.name)
+	nodes := c.serverNodes()
+	c.parallel(display, len(nodes), 0, func(i int) ([]byte, error) {
+		session, err := newSSHSession(c.user(nodes[i]), c.host(nodes[i]))
+		if err != nil {
+			return nil, err
+		}
+		defer session.Close()
+
+		return session.CombinedOutput("rm -fr " + r.snapshotDir(c, nodes[i]))
+	})
+	d.snapshot = false
+}
+
+func takeSnapshot(c *cluster) {
+	r := cockroach{}
+	display := fmt.Sprintf("%s: snapshotting stores", c.name)
+	nodes := c.serverNodes()
+	c.parallel(display, len(nodes), 0, func(i int) ([]byte, error) {
+		session, err := newSSHSession(c.user(nodes[i]), c.host(nodes[i]))
+		if err != nil {
+			return nil, err
+		}
+		defer session.Close()
+
+		src, dest := r.dataDir(c, nodes[i]), r.snapshotDir(c, nodes[i])
+		return session.CombinedOutput(fmt.Sprintf("rm -fr %s && cp -a %s %s", dest, src, dest))
+	})
+}
+
+func restoreSnapshot(c *cluster) {
+	r := cockroach{}
+	display := fmt.Sprintf("%s: restoring stores", c.name)
+	nodes := c.serverNodes()
+	c.parallel(display, len(nodes), 0, func(i int) ([]byte, error) {
+		session, err := newSSHSession(c.user(nodes[i]), c.host(nodes[i]))
+		if err != nil {
+			return nil, err
+		}
+		defer session.Close()
+
+		src, dest := r.snapshotDir(c, nodes[i]), r.dataDir(c, nodes[i])
+		return session.CombinedOutput(fmt.Sprintf("rm -fr %s && cp -a %s %s", dest, src, dest))
+	})
+}
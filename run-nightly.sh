@@ -31,6 +31,14 @@ roachperf teamcity-nightly put ./kv ./kv
 
 cd artifacts
 roachperf teamcity-nightly test nightly
+# ROACHPERF_BASELINE enables the regression check. It is either "s3", the
+# previous nightly tests uploaded below, or a directory of tests available in
+# this container.
+status=0
+if [ -n "${ROACHPERF_BASELINE}" ]; then
+  roachperf check $(ls) --baseline="${ROACHPERF_BASELINE}" || status=$?
+fi
 roachperf upload $(ls)
 
 roachprod -u teamcity destroy teamcity-nightly
+exit $status
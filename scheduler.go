@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// schedulerPoll is the interval at which the scheduler checks the queue.
+var schedulerPoll = 10 * time.Second
+
+// scheduler runs the queued tests. The tests on a cluster are run sequentially
+// in the order they were added, and tests on different clusters are run in
+// parallel. A test is not started while its cluster is locked by a test run
+// outside of the scheduler. Each test is run by a separate roachperf process
+// whose state is persisted in the queue, so a restarted scheduler resumes the
+// tests which were interrupted.
+func scheduler() error {
+	if err := flockFile(filepath.Join(os.ExpandEnv(queueDir), "scheduler.lock")); err != nil {
+		return fmt.Errorf("scheduler is already running: %s", err)
+	}
+	fmt.Printf("scheduling tests in %s\n", os.ExpandEnv(queueDir))
+
+	type exit struct {
+		job *queueJob
+		err error
+	}
+	exits := make(chan exit)
+	// running holds the tests started by this scheduler, keyed by cluster.
+	running := map[string]*queueJob{}
+
+	for {
+		jobs, err := loadQueue()
+		if err != nil {
+			return err
+		}
+
+		busy := map[string]bool{}
+		for _, j := range jobs {
+			if j.State != jobRunning {
+				continue
+			}
+			if running[j.Cluster] != nil && running[j.Cluster].ID == j.ID {
+				busy[j.Cluster] = true
+				continue
+			}
+			// The test was started by a previous scheduler. If its process is
+			// still running, wait for it to exit and then queue the test again
+			// as its exit status is unknown. Resuming a completed test is a
+			// no-op.
+			if processAlive(j.PID) {
+				busy[j.Cluster] = true
+				continue
+			}
+			fmt.Printf("%s: %s: requeuing interrupted test\n", j.ID, j.Cluster)
+			j.State = jobQueued
+			j.PID = 0
+			if err := j.save(); err != nil {
+				return err
+			}
+		}
+
+		for _, j := range jobs {
+			if j.State != jobQueued || busy[j.Cluster] {
+				continue
+			}
+			busy[j.Cluster] = true
+			if clusterLocked(j.Cluster) {
+				continue
+			}
+			cmd, err := startJob(j)
+			if err != nil {
+				j.State = jobFailed
+				j.Error = err.Error()
+				if err := j.save(); err != nil {
+					return err
+				}
+				continue
+			}
+			fmt.Printf("%s: %s: started test %s (pid %d)\n", j.ID, j.Cluster, j.Args[0], j.PID)
+			running[j.Cluster] = j
+			go func(j *queueJob) {
+				exits <- exit{j, cmd.Wait()}
+			}(j)
+		}
+
+		select {
+		case e := <-exits:
+			j := e.job
+			delete(running, j.Cluster)
+			j.Finished = time.Now()
+			j.PID = 0
+			if exitErr, ok := e.err.(*exec.ExitError); ok && exitErr.ExitCode() == exitClusterLocked {
+				// The cluster was locked by another test after it was checked
+				// above. Queue the test again to run once the lock is released.
+				fmt.Printf("%s: %s: cluster locked, requeuing test\n", j.ID, j.Cluster)
+				j.State = jobQueued
+				j.Started = time.Time{}
+				j.Finished = time.Time{}
+				if err := j.save(); err != nil {
+					return err
+				}
+				continue
+			}
+			if e.err == nil && j.testDir() == "" {
+				// The test process exits successfully only once every run of the
+				// test completed, which must have left its output directory.
+				e.err = fmt.Errorf("test exited without output")
+			}
+			if e.err != nil {
+				j.State = jobFailed
+				j.Error = e.err.Error()
+			} else {
+				j.State = jobDone
+				j.Error = ""
+			}
+			fmt.Printf("%s: %s: %s\n", j.ID, j.Cluster, j.State)
+			if err := j.save(); err != nil {
+				return err
+			}
+		case <-time.After(schedulerPoll):
+		}
+	}
+}
+
+// startJob starts the roachperf process running the test. The process runs in
+// the job directory and is placed in its own process group so that it is not
+// interrupted along with the scheduler. The test is resumed if it was
+// previously started.
+func startJob(j *queueJob) (*exec.Cmd, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	logFile, err := os.OpenFile(filepath.Join(j.dir(), "log"),
+		os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer logFile.Close()
+
+	args := append([]string(nil), j.Args...)
+	if dir := j.testDir(); dir != "" {
+		args[0] = dir
+	}
+	cmd := exec.Command(self, append([]string{j.Cluster, "test"}, args...)...)
+	cmd.Dir = j.dir()
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	j.State = jobRunning
+	j.Started = time.Now()
+	j.Finished = time.Time{}
+	j.PID = cmd.Process.Pid
+	j.Error = ""
+	if err := j.save(); err != nil {
+		return nil, err
+	}
+	return cmd, nil
+}
+
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	return syscall.Kill(pid, 0) == nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// sloP99 is the p99 latency target of the SLO search. If zero, tests sweep
+// the concurrency range instead.
+var sloP99 time.Duration
+
+// sloResult is the headline result of a latency SLO search: the maximum
+// throughput for which the p99 latency met the target. Concurrency is zero if
+// no concurrency met the target.
+type sloResult struct {
+	P99Target   float64 // ms
+	Concurrency int     `json:",omitempty"`
+	OpsSec      float64 `json:",omitempty"`
+	P99Lat      float64 `json:",omitempty"`
+}
+
+func (r *sloResult) target() time.Duration {
+	return time.Duration(r.P99Target * float64(time.Millisecond))
+}
+
+// sloSearch returns the run with the maximum throughput in the concurrency
+// range [lo, hi] whose p99 latency is at most target (ms). The concurrency is
+// doubled until the target is missed and then the gap between the highest
+// concurrency meeting the target and the lowest missing it is bisected until
+// it is no larger than precision. This assumes that latency increases with
+// concurrency. The run for a concurrency is performed by probe. Returns nil if
+// no concurrency met the target.
+func sloSearch(
+	lo, hi, precision int, target float64, probe func(concurrency int) (*testRun, error),
+) (*testRun, error) {
+	if precision < 1 {
+		precision = 1
+	}
+	var best *testRun
+	try := func(concurrency int) (bool, error) {
+		r, err := probe(concurrency)
+		if err != nil {
+			return false, err
+		}
+		fmt.Printf("slo probe: concurrency=%d ops/sec=%.1f p99=%.1fms target=%.1fms\n",
+			concurrency, r.OpsSec, r.P99Lat, target)
+		if r.P99Lat > target {
+			return false, nil
+		}
+		if best == nil || r.OpsSec > best.OpsSec {
+			best = r
+		}
+		return true, nil
+	}
+
+	var pass, fail int
+	for concurrency := lo; ; {
+		ok, err := try(concurrency)
+		if err != nil {
+			return best, err
+		}
+		if !ok {
+			fail = concurrency
+			break
+		}
+		pass = concurrency
+		if concurrency >= hi {
+			return best, nil
+		}
+		if concurrency *= 2; concurrency > hi {
+			concurrency = hi
+		}
+	}
+	if pass == 0 {
+		return nil, nil
+	}
+
+	for fail-pass > precision {
+		concurrency := (pass + fail) / 2
+		ok, err := try(concurrency)
+		if err != nil {
+			return best, err
+		}
+		if ok {
+			pass = concurrency
+		} else {
+			fail = concurrency
+		}
+	}
+	return best, nil
+}
+
+// sloTest searches for the maximum throughput of the test meeting the p99
+// latency target, recording every probe as a run in dir and the result in
+// the test metadata.
+func sloTest(c *cluster, dir string, m testMetadata, lo, hi, step int) error {
+	target := sloP99.Seconds() * 1000
+	best, err := sloSearch(lo, hi, step, target, func(concurrency int) (*testRun, error) {
+		if err := kvRun(c, dir, &m, "", concurrency); err != nil {
+			return nil, err
+		}
+		return loadConcurrencyRun(dir, concurrency)
+	})
+	if err != nil {
+		return err
+	}
+
+	m.SLO = &sloResult{P99Target: target}
+	if best == nil {
+		fmt.Printf("%s: no concurrency met the p99 target of %s\n", c.name, sloP99)
+	} else {
+		m.SLO.Concurrency = best.Concurrency
+		m.SLO.OpsSec = best.OpsSec
+		m.SLO.P99Lat = best.P99Lat
+		fmt.Printf("%s: max throughput with p99 <= %s: %.1f ops/sec (concurrency=%d p99=%.1fms)\n",
+			c.name, sloP99, best.OpsSec, best.Concurrency, best.P99Lat)
+	}
+	saveJSON(filepath.Join(dir, "metadata"), m)
+	registerResult(dir)
+	return nil
+}
+
+// loadConcurrencyRun returns the mean of the repetitions of the run at the
+// specified concurrency.
+func loadConcurrencyRun(dir string, concurrency int) (*testRun, error) {
+	start, err := loadMetadataMeasureStart(dir)
+	if err != nil {
+		return nil, err
+	}
+	var samples []*testRun
+	for i := 1; i <= repeat; i++ {
+		name := testRunName("", concurrency, i)
+		r, err := loadMeasuredRun(dir, name, start)
+		if err != nil {
+			return nil, err
+		}
+		if r == nil {
+			return nil, fmt.Errorf("%s: no results for run %s", dir, name)
+		}
+		samples = append(samples, r)
+	}
+	return meanTestRun(samples), nil
+}
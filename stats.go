@@ -0,0 +1,204 @@
+package main
+
+import (
+	"math"
+)
+
+// significanceLevel is the p-value below which the difference between two sets
+// of samples is considered statistically significant.
+const significanceLevel = 0.05
+
+type sampleStats struct {
+	N      int
+	Mean   float64
+	Stddev float64
+	// CI is the half-width of the 95% confidence interval of the mean. It is NaN
+	// if there are fewer than two samples.
+	CI float64
+}
+
+func computeStats(xs []float64) sampleStats {
+	s := sampleStats{N: len(xs), Stddev: math.NaN(), CI: math.NaN()}
+	if s.N == 0 {
+		s.Mean = math.NaN()
+		return s
+	}
+	for _, x := range xs {
+		s.Mean += x
+	}
+	s.Mean /= float64(s.N)
+	if s.N < 2 {
+		return s
+	}
+	var ss float64
+	for _, x := range xs {
+		ss += (x - s.Mean) * (x - s.Mean)
+	}
+	s.Stddev = math.Sqrt(ss / float64(s.N-1))
+	s.CI = studentTQuantile(0.975, float64(s.N-1)) * s.Stddev / math.Sqrt(float64(s.N))
+	return s
+}
+
+// welchTTest returns the two-sided p-value of Welch's t-test for the null
+// hypothesis that the samples a and b have equal means. The p-value is NaN if
+// either set contains fewer than two samples.
+func welchTTest(a, b []float64) float64 {
+	sa, sb := computeStats(a), computeStats(b)
+	if sa.N < 2 || sb.N < 2 {
+		return math.NaN()
+	}
+	va := sa.Stddev * sa.Stddev / float64(sa.N)
+	vb := sb.Stddev * sb.Stddev / float64(sb.N)
+	if va+vb == 0 {
+		if sa.Mean == sb.Mean {
+			return 1
+		}
+		return 0
+	}
+	t := (sa.Mean - sb.Mean) / math.Sqrt(va+vb)
+	df := (va + vb) * (va + vb) /
+		(va*va/float64(sa.N-1) + vb*vb/float64(sb.N-1))
+	return 2 * (1 - studentTCDF(math.Abs(t), df))
+}
+
+// studentTCDF returns the cumulative distribution function of Student's
+// t-distribution with df degrees of freedom.
+func studentTCDF(t, df float64) float64 {
+	x := df / (df + t*t)
+	p := 0.5 * regIncBeta(df/2, 0.5, x)
+	if t > 0 {
+		return 1 - p
+	}
+	return p
+}
+
+// studentTQuantile returns the value t for which studentTCDF(t, df) == p.
+func studentTQuantile(p, df float64) float64 {
+	lo, hi := -1000.0, 1000.0
+	for i := 0; i < 100; i++ {
+		mid := (lo + hi) / 2
+		if studentTCDF(mid, df) < p {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return (lo + hi) / 2
+}
+
+// regIncBeta returns the regularized incomplete beta function I_x(a, b),
+// evaluated using a continued fraction.
+func regIncBeta(a, b, x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+	lga, _ := math.Lgamma(a)
+	lgb, _ := math.Lgamma(b)
+	lgab, _ := math.Lgamma(a + b)
+	front := math.Exp(lgab - lga - lgb + a*math.Log(x) + b*math.Log(1-x))
+	// The continued fraction converges rapidly for x < (a+1)/(a+b+2). Use the
+	// symmetry relation otherwise.
+	if x < (a+1)/(a+b+2) {
+		return front * betaCF(a, b, x) / a
+	}
+	return 1 - front*betaCF(b, a, 1-x)/b
+}
+
+func betaCF(a, b, x float64) float64 {
+	const maxIter = 200
+	const eps = 1e-14
+	const tiny = 1e-300
+
+	qab := a + b
+	qap := a + 1
+	qam := a - 1
+	c := 1.0
+	d := 1 - qab*x/qap
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	h := d
+	for m := 1; m <= maxIter; m++ {
+		m2 := float64(2 * m)
+		fm := float64(m)
+		aa := fm * (b - fm) * x / ((qam + m2) * (a + m2))
+		d = 1 + aa*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + aa/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		h *= d * c
+		aa = -(a + fm) * (qab + fm) * x / ((a + m2) * (qap + m2))
+		d = 1 + aa*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + aa/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		del := d * c
+		h *= del
+		if math.Abs(del-1) < eps {
+			break
+		}
+	}
+	return h
+}
+
+// metric describes one of the measurements reported for a test run.
+type metric struct {
+	name           string
+	get            func(r *testRun) float64
+	higherIsBetter bool
+}
+
+var metrics = []metric{
+	{"ops/sec", func(r *testRun) float64 { return r.OpsSec }, true},
+	{"avg(ms)", func(r *testRun) float64 { return r.AvgLat }, false},
+	{"p50(ms)", func(r *testRun) float64 { return r.P50Lat }, false},
+	{"p95(ms)", func(r *testRun) float64 { return r.P95Lat }, false},
+	{"p99(ms)", func(r *testRun) float64 { return r.P99Lat }, false},
+}
+
+// samples returns the values of the metric for each of the repetitions of a
+// run.
+func (m metric) samples(r *testRun) []float64 {
+	if len(r.Samples) == 0 {
+		return []float64{m.get(r)}
+	}
+	xs := make([]float64, len(r.Samples))
+	for i, s := range r.Samples {
+		xs[i] = m.get(s)
+	}
+	return xs
+}
+
+// comparison summarizes the difference of a metric between two runs.
+type comparison struct {
+	Base, New   sampleStats
+	Delta       float64 // percent
+	P           float64
+	Significant bool
+}
+
+func compareRuns(m metric, base, new *testRun) comparison {
+	a, b := m.samples(base), m.samples(new)
+	c := comparison{
+		Base: computeStats(a),
+		New:  computeStats(b),
+		P:    welchTTest(a, b),
+	}
+	c.Delta = 100 * (c.New.Mean - c.Base.Mean) / c.Base.Mean
+	c.Significant = c.P < significanceLevel
+	return c
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRegIncBeta(t *testing.T) {
+	testCases := []struct {
+		a, b, x  float64
+		expected float64
+	}{
+		{1, 1, 0.3, 0.3},
+		{2, 1, 0.9, 0.81},
+		{3, 1, 0.5, 0.125},
+		{2, 3, 0.2, 0.1808},
+		{5, 5, 0.5, 0.5},
+		{2, 2, 0, 0},
+		{2, 2, 1, 1},
+	}
+	for _, c := range testCases {
+		if v := regIncBeta(c.a, c.b, c.x); math.Abs(v-c.expected) > 1e-9 {
+			t.Errorf("I_%g(%g, %g): expected %g, got %g", c.x, c.a, c.b, c.expected, v)
+		}
+	}
+}
+
+func TestStudentT(t *testing.T) {
+	// The CDF of 1 and 2 degrees of freedom has a closed form.
+	testCases := []struct {
+		t, df    float64
+		expected float64
+	}{
+		{0, 3, 0.5},
+		{1, 1, 0.75},
+		{-3, 1, 0.5 - math.Atan(3)/math.Pi},
+		{2, 2, 0.5 + 2/(2*math.Sqrt(6))},
+		{-0.5, 2, 0.5 - 0.5/(2*math.Sqrt(2.25))},
+	}
+	for _, c := range testCases {
+		if v := studentTCDF(c.t, c.df); math.Abs(v-c.expected) > 1e-9 {
+			t.Errorf("cdf(%g, df=%g): expected %g, got %g", c.t, c.df, c.expected, v)
+		}
+	}
+
+	// The two-sided 95% critical values of the t-distribution.
+	quantiles := []struct {
+		df       float64
+		expected float64
+	}{
+		{1, 12.706205},
+		{4, 2.776445},
+		{10, 2.228139},
+		{30, 2.042272},
+	}
+	for _, c := range quantiles {
+		if v := studentTQuantile(0.975, c.df); math.Abs(v-c.expected) > 1e-5 {
+			t.Errorf("quantile(0.975, df=%g): expected %g, got %g", c.df, c.expected, v)
+		}
+	}
+}
+
+func TestComputeStats(t *testing.T) {
+	s := computeStats([]float64{1, 2, 3, 4, 5})
+	if s.N != 5 || s.Mean != 3 || math.Abs(s.Stddev-math.Sqrt(2.5)) > 1e-9 {
+		t.Fatalf("unexpected stats: %+v", s)
+	}
+	// t(0.975, 4) * stddev / sqrt(n)
+	if expected := 2.776445 * math.Sqrt(0.5); math.Abs(s.CI-expected) > 1e-5 {
+		t.Fatalf("ci: expected %g, got %g", expected, s.CI)
+	}
+	if s := computeStats([]float64{1}); !math.IsNaN(s.CI) {
+		t.Fatalf("ci of a single sample: expected NaN, got %g", s.CI)
+	}
+}
+
+func TestWelchTTest(t *testing.T) {
+	testCases := []struct {
+		a, b     []float64
+		expected float64
+	}{
+		// t = -2√2 with 2 degrees of freedom.
+		{[]float64{0, 2}, []float64{4, 6}, 1 - 2/math.Sqrt(5)},
+		// t = -2 with 1 degree of freedom, as a has no variance.
+		{[]float64{1, 1}, []float64{2, 4}, 1 - 2*math.Atan(2)/math.Pi},
+		{[]float64{1, 2, 3}, []float64{1, 2, 3}, 1},
+		{[]float64{1, 1}, []float64{2, 2}, 0},
+	}
+	for _, c := range testCases {
+		if p := welchTTest(c.a, c.b); math.Abs(p-c.expected) > 1e-9 {
+			t.Errorf("%v vs %v: expected p=%g, got %g", c.a, c.b, c.expected, p)
+		}
+	}
+	if p := welchTTest([]float64{1}, []float64{2, 3}); !math.IsNaN(p) {
+		t.Errorf("expected NaN for a single sample, got %g", p)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// sweeps are the parameter sweeps of a test (see --sweep). Each is of the form
+// <name>=<values>, where <values> is a sweep spec.
+var sweeps []string
+
+var sweepNameRE = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+var sweepValueRE = regexp.MustCompile(`^[A-Za-z0-9.:+-]+$`)
+
+// parseRange parses a sweep spec item of the form <lo>[-<hi>[/<step>|x<factor>]]
+// and returns the values it spans. The bounds are multiplied by scale. A range
+// without a step or factor increments by defStep.
+func parseRange(item string, scale, defStep int) ([]int, error) {
+	bad := func() ([]int, error) {
+		return nil, fmt.Errorf("invalid range %q: expected <lo>[-<hi>[/<step>|x<factor>]]", item)
+	}
+	s := item
+	step, factor := defStep, 0
+	if i := strings.IndexAny(s, "/x"); i != -1 {
+		n, err := strconv.Atoi(s[i+1:])
+		if err != nil || n <= 0 {
+			return bad()
+		}
+		if s[i] == '/' {
+			step = n
+		} else {
+			if n < 2 {
+				return nil, fmt.Errorf("invalid range %q: factor must be at least 2", item)
+			}
+			factor = n
+		}
+		s = s[:i]
+		if !strings.Contains(s, "-") {
+			return bad()
+		}
+	}
+
+	parts := strings.SplitN(s, "-", 2)
+	lo, err := strconv.Atoi(parts[0])
+	if err != nil || lo < 0 {
+		return bad()
+	}
+	hi := lo
+	if len(parts) == 2 {
+		if hi, err = strconv.Atoi(parts[1]); err != nil {
+			return bad()
+		}
+	}
+	if hi < lo {
+		return nil, fmt.Errorf("invalid range %q: %d < %d", item, hi, lo)
+	}
+	lo, hi = lo*scale, hi*scale
+	if factor != 0 && lo == 0 {
+		return nil, fmt.Errorf("invalid range %q: geometric range must start above 0", item)
+	}
+
+	var r []int
+	for v := lo; v <= hi; {
+		r = append(r, v)
+		if factor != 0 {
+			v *= factor
+		} else {
+			v += step
+		}
+	}
+	return r, nil
+}
+
+// parseConcurrency parses a concurrency spec: a comma separated list of items of
+// the form [=]<lo>[-<hi>[/<step>|x<factor>]]. For example, "1-64" runs each
+// multiple of the number of nodes up to 64 times the number of nodes, and
+// "=1-1024x2,=1500" runs powers of 2 up to 1024 and 1500. The bounds are per
+// node (multiplied by numNodes) unless prefixed by "=". The step is absolute
+// and defaults to the number of nodes. The returned concurrencies are sorted
+// and distinct.
+func parseConcurrency(s string, numNodes int) ([]int, error) {
+	seen := map[int]bool{}
+	var r []int
+	for _, item := range strings.Split(s, ",") {
+		scale := numNodes
+		if strings.HasPrefix(item, "=") {
+			item = item[1:]
+			scale = 1
+		}
+		values, err := parseRange(item, scale, numNodes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid concurrency %q: %s", s, err)
+		}
+		for _, v := range values {
+			if v <= 0 {
+				return nil, fmt.Errorf("invalid concurrency %q: concurrency must be positive", s)
+			}
+			if !seen[v] {
+				seen[v] = true
+				r = append(r, v)
+			}
+		}
+	}
+	sort.Ints(r)
+	return r, nil
+}
+
+// parseSweep parses a parameter sweep of the form <name>=<values>, where
+// <values> is a comma separated list of values or numeric ranges of the form
+// <lo>-<hi>[/<step>|x<factor>]. For example, "read-percent=0-100/50" and
+// "batch=1,10,100".
+func parseSweep(s string) (name string, values []string, err error) {
+	i := strings.Index(s, "=")
+	if i == -1 {
+		return "", nil, fmt.Errorf("invalid sweep %q: expected <name>=<values>", s)
+	}
+	name = s[:i]
+	if !sweepNameRE.MatchString(name) {
+		return "", nil, fmt.Errorf("invalid sweep %q: invalid parameter name %q", s, name)
+	}
+	seen := map[string]bool{}
+	for _, item := range strings.Split(s[i+1:], ",") {
+		var vals []string
+		if r, err := parseRange(item, 1, 1); err == nil {
+			for _, v := range r {
+				vals = append(vals, strconv.Itoa(v))
+			}
+		} else if strings.ContainsAny(item, "/x") && strings.Contains(item, "-") {
+			return "", nil, fmt.Errorf("invalid sweep %q: %s", s, err)
+		} else if !sweepValueRE.MatchString(item) {
+			return "", nil, fmt.Errorf("invalid sweep %q: invalid value %q", s, item)
+		} else {
+			vals = []string{item}
+		}
+		for _, v := range vals {
+			if !seen[v] {
+				seen[v] = true
+				values = append(values, v)
+			}
+		}
+	}
+	return name, values, nil
+}
+
+// sweepCombinations returns the parameters of each combination of the values
+// of the sweeps, formatted as <name>=<value>[,<name>=<value>...]. Without
+// sweeps there is a single combination with no parameters.
+func sweepCombinations(sweeps []string) ([]string, error) {
+	combos := []string{""}
+	names := map[string]bool{}
+	for _, s := range sweeps {
+		name, values, err := parseSweep(s)
+		if err != nil {
+			return nil, err
+		}
+		if names[name] {
+			return nil, fmt.Errorf("parameter %q swept more than once", name)
+		}
+		names[name] = true
+
+		var next []string
+		for _, c := range combos {
+			for _, v := range values {
+				p := name + "=" + v
+				if c != "" {
+					p = c + "," + p
+				}
+				next = append(next, p)
+			}
+		}
+		combos = next
+	}
+	return combos, nil
+}
+
+// paramFlags returns the command line flags setting the parameters of a run.
+func paramFlags(params string) string {
+	if params == "" {
+		return ""
+	}
+	var flags string
+	for _, p := range strings.Split(params, ",") {
+		flags += " --" + p
+	}
+	return flags
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRange(t *testing.T) {
+	testCases := []struct {
+		item     string
+		scale    int
+		defStep  int
+		expected []int
+	}{
+		{"5", 1, 1, []int{5}},
+		{"1-4", 1, 1, []int{1, 2, 3, 4}},
+		{"1-4", 2, 2, []int{2, 4, 6, 8}},
+		{"0-100/25", 1, 1, []int{0, 25, 50, 75, 100}},
+		{"0-10/4", 1, 1, []int{0, 4, 8}},
+		{"1-64x2", 1, 1, []int{1, 2, 4, 8, 16, 32, 64}},
+		{"1-100x3", 1, 1, []int{1, 3, 9, 27, 81}},
+		{"1-4x2", 3, 3, []int{3, 6, 12}},
+	}
+	for _, c := range testCases {
+		r, err := parseRange(c.item, c.scale, c.defStep)
+		if err != nil {
+			t.Errorf("%s: %s", c.item, err)
+			continue
+		}
+		if !reflect.DeepEqual(r, c.expected) {
+			t.Errorf("%s (scale=%d): expected %v, got %v", c.item, c.scale, c.expected, r)
+		}
+	}
+
+	for _, item := range []string{
+		"", "a", "-1", "4-2", "1-", "1-4/0", "1-4/a", "1-4x1", "0-4x2", "4/2", "4x2",
+	} {
+		if r, err := parseRange(item, 1, 1); err == nil {
+			t.Errorf("%q: expected an error, got %v", item, r)
+		}
+	}
+}
+
+func TestParseConcurrency(t *testing.T) {
+	testCases := []struct {
+		spec     string
+		numNodes int
+		expected []int
+	}{
+		// Bounds and the default step are per node.
+		{"1-4", 3, []int{3, 6, 9, 12}},
+		{"2", 3, []int{6}},
+		{"1-8x2", 3, []int{3, 6, 12, 24}},
+		// Absolute bounds are not scaled.
+		{"=4-16/4", 3, []int{4, 8, 12, 16}},
+		{"=1-1024x2,=1500", 3, []int{1, 2, 4, 8, 16, 32, 64, 128, 256, 512, 1024, 1500}},
+		// Lists are sorted and distinct.
+		{"=5,1,2", 2, []int{2, 4, 5}},
+		{"=2,1,1-2", 2, []int{2, 4}},
+	}
+	for _, c := range testCases {
+		r, err := parseConcurrency(c.spec, c.numNodes)
+		if err != nil {
+			t.Errorf("%s: %s", c.spec, err)
+			continue
+		}
+		if !reflect.DeepEqual(r, c.expected) {
+			t.Errorf("%s (nodes=%d): expected %v, got %v", c.spec, c.numNodes, c.expected, r)
+		}
+	}
+
+	for _, spec := range []string{"", "0", "=0", "=0-4", "1,", "=1-8x1", "=0-8x2", "a"} {
+		if r, err := parseConcurrency(spec, 3); err == nil {
+			t.Errorf("%q: expected an error, got %v", spec, r)
+		}
+	}
+}
+
+func TestParseSweep(t *testing.T) {
+	testCases := []struct {
+		spec     string
+		name     string
+		expected []string
+	}{
+		{"read-percent=0-100/50", "read-percent", []string{"0", "50", "100"}},
+		{"batch=1,10,100", "batch", []string{"1", "10", "100"}},
+		{"batch=1-8x2", "batch", []string{"1", "2", "4", "8"}},
+		{"x=0.5,1", "x", []string{"0.5", "1"}},
+		{"method=upsert,insert,upsert", "method", []string{"upsert", "insert"}},
+		{"a=1-2,2,3", "a", []string{"1", "2", "3"}},
+	}
+	for _, c := range testCases {
+		name, values, err := parseSweep(c.spec)
+		if err != nil {
+			t.Errorf("%s: %s", c.spec, err)
+			continue
+		}
+		if name != c.name || !reflect.DeepEqual(values, c.expected) {
+			t.Errorf("%s: expected %s=%v, got %s=%v", c.spec, c.name, c.expected, name, values)
+		}
+	}
+
+	for _, spec := range []string{
+		"batch", "=1", "Batch=1", "read_percent=1", "b=", "b=1,", "b=a_b", "b=1-4x1", "b=4-1/2",
+	} {
+		if _, values, err := parseSweep(spec); err == nil {
+			t.Errorf("%q: expected an error, got %v", spec, values)
+		}
+	}
+}
+
+func TestSweepCombinations(t *testing.T) {
+	combos, err := sweepCombinations(nil)
+	if err != nil || !reflect.DeepEqual(combos, []string{""}) {
+		t.Errorf("no sweeps: expected a single combination, got %q (%v)", combos, err)
+	}
+
+	combos, err = sweepCombinations([]string{"a=1,2", "b=x,y"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := []string{"a=1,b=x", "a=1,b=y", "a=2,b=x", "a=2,b=y"}; !reflect.DeepEqual(combos, e) {
+		t.Errorf("expected %q, got %q", e, combos)
+	}
+
+	if _, err := sweepCombinations([]string{"a=1", "a=2"}); err == nil {
+		t.Errorf("expected an error for a parameter swept twice")
+	}
+}
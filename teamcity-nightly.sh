@@ -9,5 +9,6 @@ docker run \
     --env="AWS_ACCESS_KEY_ID=${AWS_ACCESS_KEY_ID}" \
     --env="AWS_SECRET_ACCESS_KEY=${AWS_SECRET_ACCESS_KEY}" \
     --env="GOOGLE_CREDENTIALS=${GOOGLE_CREDENTIALS}" \
+    --env="ROACHPERF_BASELINE=${ROACHPERF_BASELINE}" \
     --rm \
     cockroachdb/builder:20171004-085709 ./run-nightly.sh
@@ -13,12 +13,19 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	yaml "gopkg.in/yaml.v2"
 )
 
 var duration time.Duration
 var concurrency string
+var repeat int
+
+// putBinDir is a directory containing a cockroach binary to upload to the
+// cluster before running a test.
+var putBinDir string
 
-var tests = map[string]func(clusterName, dir string){
+var tests = map[string]func(clusterName, dir string) error{
 	"kv_0":    kv0,
 	"kv_95":   kv95,
 	"ycsb_a":  ycsbA,
@@ -38,6 +45,26 @@ type testMetadata struct {
 	Args    []string
 	Test    string
 	Date    string
+	HAProxy bool `json:",omitempty"`
+	// CassandraConfig is the effective cassandra.yaml (excluding per-node
+	// settings) for cassandra clusters.
+	CassandraConfig string `json:",omitempty"`
+	// SLO is the target and result of a latency SLO search.
+	SLO *sloResult `json:",omitempty"`
+	// Sweeps are the parameter sweeps of the test (see --sweep).
+	Sweeps []string `json:",omitempty"`
+	// Chaos are the faults injected during each run (see --chaos).
+	Chaos []string `json:",omitempty"`
+	// Warmup and Ramp are the periods at the start of each run which are
+	// excluded from the results (see --warmup and --ramp).
+	Warmup string `json:",omitempty"`
+	Ramp   string `json:",omitempty"`
+	// Reuse is the data reuse mode of the runs (see --reuse).
+	Reuse string `json:",omitempty"`
+	// Load is the command of the load phase of the test, if any, which
+	// inserts LoadRows rows (see --load-rows).
+	Load     string `json:",omitempty"`
+	LoadRows int    `json:",omitempty"`
 }
 
 type testRun struct {
@@ -50,14 +77,76 @@ type testRun struct {
 	P50Lat      float64
 	P95Lat      float64
 	P99Lat      float64
+	// Name is set for runs which are identified by name rather than
+	// concurrency, such as those of the nightly test.
+	Name string `json:",omitempty"`
+	// Params holds the swept parameters of the run (e.g. read-percent=95).
+	Params string `json:",omitempty"`
+	// Metrics holds the key metrics of the nodes during the run (see
+	// nodeMetrics).
+	Metrics map[string]float64 `json:",omitempty"`
+	// Approximate is set when the latencies were approximated from the
+	// intervals after the warm-up (see measureRun).
+	Approximate bool `json:",omitempty"`
+	// Samples holds the individual repetitions of a run performed with
+	// --repeat. The other fields contain the mean of the samples.
+	Samples []*testRun `json:",omitempty"`
 }
 
-func loadTestRun(dir, name string) (*testRun, error) {
-	n, err := strconv.Atoi(name)
+// testRunName returns the name of the file holding the output of a run. The
+// first repetition of a run is named by the concurrency alone, prefixed by the
+// swept parameters of the run, if any.
+func testRunName(params string, concurrency, repeat int) string {
+	name := fmt.Sprint(concurrency)
+	if repeat > 1 {
+		name = fmt.Sprintf("%d.%d", concurrency, repeat)
+	}
+	if params != "" {
+		name = params + "_" + name
+	}
+	return name
+}
+
+func parseTestRunName(name string) (params string, concurrency int, ok bool) {
+	if i := strings.LastIndex(name, "_"); i != -1 {
+		params, name = name[:i], name[i+1:]
+		if !strings.Contains(params, "=") {
+			return "", 0, false
+		}
+	}
+	parts := strings.Split(name, ".")
+	if len(parts) > 2 {
+		return "", 0, false
+	}
+	if len(parts) == 2 {
+		if _, err := strconv.Atoi(parts[1]); err != nil {
+			return "", 0, false
+		}
+	}
+	n, err := strconv.Atoi(parts[0])
 	if err != nil {
+		return "", 0, false
+	}
+	return params, n, true
+}
+
+// key returns the name or parameters and concurrency identifying a run.
+func (r *testRun) key() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return testRunName(r.Params, r.Concurrency, 1)
+}
+
+func loadTestRun(dir, name string) (*testRun, error) {
+	var r *testRun
+	if params, n, ok := parseTestRunName(name); ok {
+		r = &testRun{Concurrency: n, Params: params}
+	} else if isNightlyRun(name) {
+		r = &testRun{Name: name}
+	} else {
 		return nil, nil
 	}
-	r := &testRun{Concurrency: n}
 
 	b, err := ioutil.ReadFile(filepath.Join(dir, name))
 	if err != nil {
@@ -79,12 +168,62 @@ func loadTestRun(dir, name string) (*testRun, error) {
 	return r, nil
 }
 
+// runInterval is a line of the per-interval output of a load generator.
+type runInterval struct {
+	Elapsed   float64
+	Errors    int64
+	OpsSec    float64
+	OpsSecCum float64
+	P50Lat    float64
+	P95Lat    float64
+	P99Lat    float64
+	PMaxLat   float64
+}
+
+// loadRunIntervals parses the per-interval output of a run. The interval
+// header is repeated periodically in the output and the intervals end at the
+// summary header.
+func loadRunIntervals(dir, name string) ([]runInterval, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return nil, err
+	}
+
+	const header = `_elapsed___errors__ops/sec(inst)___ops/sec(cum)__p50(ms)__p95(ms)__p99(ms)_pMax(ms)`
+	var intervals []runInterval
+	var inIntervals bool
+	for _, line := range strings.Split(string(b), "\n") {
+		switch {
+		case strings.HasPrefix(line, header):
+			inIntervals = true
+			continue
+		case strings.HasPrefix(line, "_elapsed"):
+			inIntervals = false
+			continue
+		case !inIntervals:
+			continue
+		}
+		var r runInterval
+		if _, err := fmt.Sscanf(line, " %fs %d %f %f %f %f %f %f",
+			&r.Elapsed, &r.Errors, &r.OpsSec, &r.OpsSecCum,
+			&r.P50Lat, &r.P95Lat, &r.P99Lat, &r.PMaxLat); err != nil {
+			continue
+		}
+		intervals = append(intervals, r)
+	}
+	return intervals, nil
+}
+
 type testData struct {
 	Metadata testMetadata
 	Runs     []*testRun
+	// Load is the mean of the load phases of the runs, if the test has a load
+	// phase.
+	Load *testRun `json:",omitempty"`
 }
 
 func loadTestData(dir string) (*testData, error) {
+	dir = resolveTestDir(dir)
 	d := &testData{}
 	if err := loadJSON(filepath.Join(dir, "metadata"), &d.Metadata); err != nil {
 		return nil, err
@@ -95,90 +234,126 @@ func loadTestData(dir string) (*testData, error) {
 		return nil, err
 	}
 
+	start := d.Metadata.measureStart()
+	var samples, loads []*testRun
 	for _, e := range ents {
-		r, err := loadTestRun(dir, e.Name())
+		if d.Metadata.Load != "" && strings.HasSuffix(e.Name(), ".events") {
+			events, err := loadRunEvents(dir, strings.TrimSuffix(e.Name(), ".events"))
+			if err != nil {
+				return nil, err
+			}
+			if r := loadPhaseRun(events, d.Metadata.LoadRows); r != nil {
+				loads = append(loads, r)
+			}
+			continue
+		}
+		r, err := loadMeasuredRun(dir, e.Name(), start)
 		if err != nil {
 			return nil, err
 		}
 		if r != nil {
-			d.Runs = append(d.Runs, r)
+			samples = append(samples, r)
 		}
 	}
 
-	sort.Slice(d.Runs, func(i, j int) bool {
-		return d.Runs[i].Concurrency < d.Runs[j].Concurrency
+	sort.SliceStable(samples, func(i, j int) bool {
+		if samples[i].Name != samples[j].Name {
+			return samples[i].Name < samples[j].Name
+		}
+		if samples[i].Params != samples[j].Params {
+			return samples[i].Params < samples[j].Params
+		}
+		return samples[i].Concurrency < samples[j].Concurrency
 	})
+	for i := 0; i < len(samples); {
+		j := i + 1
+		for j < len(samples) && samples[j].key() == samples[i].key() {
+			j++
+		}
+		d.Runs = append(d.Runs, meanTestRun(samples[i:j]))
+		i = j
+	}
+	if len(loads) > 0 {
+		d.Load = meanTestRun(loads)
+	}
 	return d, nil
 }
 
-func (d *testData) exists(concurrency int) bool {
-	i := sort.Search(len(d.Runs), func(j int) bool {
-		return d.Runs[j].Concurrency >= concurrency
-	})
-	return i < len(d.Runs) && d.Runs[i].Concurrency == concurrency
+// meanTestRun returns a run containing the mean of the specified repetitions
+// of a run. A run which wasn't repeated is returned as is.
+func meanTestRun(samples []*testRun) *testRun {
+	if len(samples) == 1 {
+		return samples[0]
+	}
+	r := &testRun{
+		Concurrency: samples[0].Concurrency,
+		Name:        samples[0].Name,
+		Params:      samples[0].Params,
+		Approximate: samples[0].Approximate,
+		Samples:     samples,
+	}
+	for _, s := range samples {
+		r.Elapsed += s.Elapsed
+		r.Errors += s.Errors
+		r.Ops += s.Ops
+		r.OpsSec += s.OpsSec
+		r.AvgLat += s.AvgLat
+		r.P50Lat += s.P50Lat
+		r.P95Lat += s.P95Lat
+		r.P99Lat += s.P99Lat
+	}
+	n := float64(len(samples))
+	r.Metrics = meanMetrics(samples)
+	r.Elapsed /= n
+	r.Errors /= int64(n)
+	r.Ops /= int64(n)
+	r.OpsSec /= n
+	r.AvgLat /= n
+	r.P50Lat /= n
+	r.P95Lat /= n
+	r.P99Lat /= n
+	return r
 }
 
-func (d *testData) get(concurrency int) *testRun {
-	i := sort.Search(len(d.Runs), func(j int) bool {
-		return d.Runs[j].Concurrency >= concurrency
-	})
-	if i+1 >= len(d.Runs) {
-		return d.Runs[len(d.Runs)-1]
-	}
-	if i < 0 {
-		return d.Runs[0]
-	}
-	a := d.Runs[i]
-	b := d.Runs[i+1]
-	t := float64(concurrency-a.Concurrency) / float64(b.Concurrency-a.Concurrency)
-	return &testRun{
-		Concurrency: concurrency,
-		Elapsed:     a.Elapsed + float64(b.Elapsed-a.Elapsed)*t,
-		Ops:         a.Ops + int64(float64(b.Ops-a.Ops)*t),
-		OpsSec:      a.OpsSec + float64(b.OpsSec-a.OpsSec)*t,
-		AvgLat:      a.AvgLat + float64(b.AvgLat-a.AvgLat)*t,
-		P50Lat:      a.P50Lat + float64(b.P50Lat-a.P50Lat)*t,
-		P95Lat:      a.P95Lat + float64(b.P95Lat-a.P95Lat)*t,
-		P99Lat:      a.P99Lat + float64(b.P99Lat-a.P99Lat)*t,
+// find returns the run with the specified key, or nil if there is no such
+// run.
+func (d *testData) find(key string) *testRun {
+	for _, r := range d.Runs {
+		if r.key() == key {
+			return r
+		}
 	}
+	return nil
 }
 
-func alignTestData(d1, d2 *testData) (*testData, *testData) {
-	if len(d1.Runs) == 0 || len(d2.Runs) == 0 {
-		return &testData{Metadata: d1.Metadata}, &testData{Metadata: d2.Metadata}
-	}
-
-	minConcurrency := d1.Runs[0].Concurrency
-	if c := d2.Runs[0].Concurrency; minConcurrency < c {
-		minConcurrency = c
-	}
-	maxConcurrency := d1.Runs[len(d1.Runs)-1].Concurrency
-	if c := d2.Runs[len(d2.Runs)-1].Concurrency; maxConcurrency > c {
-		maxConcurrency = c
-	}
-
-	var r1 []*testRun
-	var r2 []*testRun
-	for i := minConcurrency; i <= maxConcurrency; i++ {
-		if !d1.exists(i) || !d2.exists(i) {
-			continue
+// alignTestDataN returns the runs present in all of the test data.
+func alignTestDataN(ds []*testData) []*testData {
+	runs := make([][]*testRun, len(ds))
+outer:
+	for _, r := range ds[0].Runs {
+		matched := make([]*testRun, len(ds))
+		for i, d := range ds {
+			if matched[i] = d.find(r.key()); matched[i] == nil {
+				continue outer
+			}
+		}
+		for i := range ds {
+			runs[i] = append(runs[i], matched[i])
 		}
-		r1 = append(r1, d1.get(i))
-		r2 = append(r2, d2.get(i))
 	}
 
-	d1 = &testData{
-		Metadata: d1.Metadata,
-		Runs:     r1,
-	}
-	d2 = &testData{
-		Metadata: d2.Metadata,
-		Runs:     r2,
+	r := make([]*testData, len(ds))
+	for i, d := range ds {
+		r[i] = &testData{
+			Metadata: d.Metadata,
+			Runs:     runs[i],
+			Load:     d.Load,
+		}
 	}
-	return d1, d2
+	return r
 }
 
-func findTest(name string) (_ func(clusterName, dir string), dir string) {
+func findTest(name string) (_ func(clusterName, dir string) error, dir string) {
 	fn := tests[name]
 	if fn != nil {
 		return fn, ""
@@ -190,6 +365,18 @@ func findTest(name string) (_ func(clusterName, dir string), dir string) {
 	return tests[m[1]], name
 }
 
+// testName returns the name of the test specified by name, which is either a
+// test or the output directory of a test.
+func testName(name string) string {
+	if tests[name] != nil {
+		return name
+	}
+	if m := dirRE.FindStringSubmatch(filepath.Base(name)); len(m) == 2 {
+		return m[1]
+	}
+	return name
+}
+
 func isTest(name string) bool {
 	fn, _ := findTest(name)
 	return fn != nil
@@ -200,8 +387,14 @@ func runTest(name, clusterName string) error {
 	if fn == nil {
 		return fmt.Errorf("unknown test: %s", name)
 	}
-	fn(clusterName, dir)
-	return nil
+	// The test exits with an error unless every run completed so that
+	// incomplete tests are resumed by the matrix and reported by the queue.
+	err := fn(clusterName, dir)
+	if isSigKill(err) {
+		// The load was killed, such as by stopping the cluster.
+		return fmt.Errorf("%s: stopped before completing", name)
+	}
+	return err
 }
 
 func allTests() []string {
@@ -221,6 +414,15 @@ func testCluster(name string) *cluster {
 	if c.loadGen == 0 {
 		log.Fatalf("%s: no load generator node specified", c.name)
 	}
+	if err := lockCluster(c.name); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitClusterLocked)
+	}
+	if putBinDir != "" {
+		if err := putBin(c, putBinDir); err != nil {
+			log.Fatal(err)
+		}
+	}
 	return c
 }
 
@@ -244,6 +446,12 @@ func clusterVersion(c *cluster) string {
 	case "cassandra":
 		return "cassandra"
 
+	case "postgres":
+		return "postgres"
+
+	case "mongodb":
+		return "mongodb"
+
 	default:
 		log.Fatalf("unsupported cluster type: %s", clusterType)
 	}
@@ -251,55 +459,42 @@ func clusterVersion(c *cluster) string {
 	panic("not reached")
 }
 
-func testDir(name, vers string) string {
-	dir := fmt.Sprintf("%s.%s", name, vers)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		log.Fatal(err)
+func newTestMetadata(c *cluster, test string) testMetadata {
+	m := testMetadata{
+		Bin:     clusterVersion(c),
+		Cluster: c.name,
+		Nodes:   c.nodes,
+		Env:     c.env,
+		Args:    c.args,
+		Test:    test,
+		Date:    time.Now().Format("2006-01-02T15_04_05"),
+		HAProxy: c.haproxy,
 	}
-	return dir
-}
-
-func parseConcurrency(s string, numNodes int) (lo int, hi int, step int) {
-	// <lo>[-<hi>[/<step>]]
-	//
-	// If <step> is not specified, assuming numNodes. The <lo> and <hi> values
-	// are always multiplied by the number of nodes.
-
-	parts := strings.Split(s, "/")
-	switch len(parts) {
-	case 1:
-		step = numNodes
-	case 2:
-		var err error
-		step, err = strconv.Atoi(parts[1])
-		if err != nil {
-			log.Fatal(err)
-		}
-		s = parts[0]
+	if sloP99 > 0 {
+		m.SLO = &sloResult{P99Target: sloP99.Seconds() * 1000}
 	}
-
-	parts = strings.Split(s, "-")
-	switch len(parts) {
-	case 1:
-		lo, err := strconv.Atoi(parts[0])
-		if err != nil {
-			log.Fatal(err)
-		}
-		return lo * numNodes, lo * numNodes, step
-	case 2:
-		lo, err := strconv.Atoi(parts[0])
+	m.Sweeps = sweeps
+	m.Chaos = chaosSpecs
+	if clusterType == "cassandra" {
+		cfg, err := cassandraConfig()
 		if err != nil {
 			log.Fatal(err)
 		}
-		hi, err := strconv.Atoi(parts[1])
+		data, err := yaml.Marshal(cfg)
 		if err != nil {
 			log.Fatal(err)
 		}
-		return lo * numNodes, hi * numNodes, step
-	default:
-		log.Fatalf("unable to parse concurrency setting: %s", s)
+		m.CassandraConfig = string(data)
 	}
-	return 0, 0, 0
+	return m
+}
+
+func testDir(name, vers string) string {
+	dir := fmt.Sprintf("%s.%s", name, vers)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Fatal(err)
+	}
+	return dir
 }
 
 func getBin(c *cluster, dir string) {
@@ -314,6 +509,22 @@ func getBin(c *cluster, dir string) {
 	}
 }
 
+// restoreBin ensures that a resumed test runs against the binary it was
+// started with, uploading the binary saved in the test directory if the
+// cluster is running a different one.
+func restoreBin(c *cluster, dir string, m, existing *testMetadata) {
+	if m.Bin == existing.Bin {
+		return
+	}
+	if err := putBin(c, dir); err != nil {
+		log.Fatalf("binary changed: %s != %s\n%s", m.Bin, existing.Bin, err)
+	}
+	if vers := clusterVersion(c); vers != existing.Bin {
+		log.Fatalf("binary changed: %s != %s", vers, existing.Bin)
+	}
+	m.Bin = existing.Bin
+}
+
 func putBin(c *cluster, dir string) error {
 	if clusterType == "cockroach" {
 		bin := filepath.Join(dir, "cockroach")
@@ -325,7 +536,12 @@ func putBin(c *cluster, dir string) error {
 	return nil
 }
 
-func kvTest(clusterName, testName, dir, cmd string) {
+// kvTest runs the load cmd at each concurrency. If load is specified, it is
+// the command of the load phase inserting the initial dataset, which is run
+// whenever the cluster is wiped. Both load and cmd are formatted with the
+// number of rows it inserts so that the keyspace of the runs covers the
+// dataset.
+func kvTest(clusterName, testName, dir, load, cmd string) error {
 	var existing *testMetadata
 	if dir != "" {
 		existing = &testMetadata{}
@@ -334,84 +550,221 @@ func kvTest(clusterName, testName, dir, cmd string) {
 		}
 		clusterName = existing.Cluster
 		nodeArgs = existing.Args
+		useHAProxy = existing.HAProxy
+		cassandraRecordedConfig = existing.CassandraConfig
+		chaosSpecs = existing.Chaos
+		if existing.SLO != nil {
+			sloP99 = existing.SLO.target()
+		}
+		sweeps = existing.Sweeps
+		warmup, ramp = existing.excluded()
+		if existing.Reuse != "" {
+			reuseMode = existing.Reuse
+		}
+		if existing.LoadRows != 0 {
+			loadRows = existing.LoadRows
+		}
 	}
 
 	c := testCluster(clusterName)
-	m := testMetadata{
-		Bin:     clusterVersion(c),
-		Cluster: c.name,
-		Nodes:   c.nodes,
-		Env:     c.env,
-		Args:    c.args,
-		Test:    fmt.Sprintf("%s --duration=%s --concurrency=%%d", cmd, duration),
-		Date:    time.Now().Format("2006-01-02T15_04_05"),
+	if load != "" {
+		cmd = fmt.Sprintf(cmd, loadRows)
+	}
+	// The warm-up is excluded from the results, so the load runs for
+	// --duration after it.
+	cmd = fmt.Sprintf("%s --duration=%s", cmd, duration+warmup)
+	m := newTestMetadata(c, cmd+" --concurrency=%d")
+	if warmup > 0 {
+		m.Warmup = warmup.String()
+	}
+	if ramp > 0 {
+		m.Ramp = ramp.String()
+	}
+	if reuseMode != reuseFresh {
+		m.Reuse = reuseMode
+	}
+	if load != "" {
+		m.Load = load
+		m.LoadRows = loadRows
 	}
 	if existing == nil {
 		dir = testDir(testName, m.Bin)
 		saveJSON(filepath.Join(dir, "metadata"), m)
 	} else {
-		if m.Bin != existing.Bin {
-			if err := putBin(c, dir); err != nil {
-				log.Fatalf("binary changed: %s != %s\n%s", m.Bin, existing.Bin, err)
-			}
-		}
+		restoreBin(c, dir, &m, existing)
 		m.Nodes = existing.Nodes
 		m.Env = existing.Env
+		m.Load = existing.Load
+		m.LoadRows = existing.LoadRows
 	}
 	fmt.Printf("%s: %s\n", c.name, dir)
+	registerResult(dir)
 	getBin(c, dir)
 
-	lo, hi, step := parseConcurrency(concurrency, len(c.serverNodes()))
-	for concurrency := lo; concurrency <= hi; concurrency += step {
-		runName := fmt.Sprint(concurrency)
+	numNodes := len(c.serverNodes())
+	concurrencies, err := parseConcurrency(concurrency, numNodes)
+	if err != nil {
+		log.Fatal(err)
+	}
+	combos, err := sweepCombinations(sweeps)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if sloP99 > 0 {
+		md := m
+		if existing != nil {
+			md = *existing
+		}
+		err = sloTest(c, dir, md, concurrencies[0], concurrencies[len(concurrencies)-1], numNodes)
+	} else {
+	outer:
+		for _, params := range combos {
+			for _, concurrency := range concurrencies {
+				if err = kvRun(c, dir, &m, params, concurrency); err != nil {
+					break outer
+				}
+			}
+		}
+	}
+	c.stop()
+	runData.cleanup(c)
+	return err
+}
+
+// executeRun performs a run, writing the output of the load to <dir>/<run>
+// and recording its steps in the event log of the run. The cluster is readied
+// for the load by prepare, and after is called once the load completes
+// successfully.
+func executeRun(
+	c *cluster, dir, run, cmd string, prepare func(*eventLog) error, after func(*eventLog),
+) error {
+	f, err := os.Create(filepath.Join(dir, run))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	events, err := newEventLog(dir, run)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer events.Close()
+
+	if err := prepare(events); err != nil {
+		return err
+	}
+	stdout := io.MultiWriter(f, os.Stdout)
+	stderr := io.MultiWriter(f, os.Stderr)
+	events.record(loadEvent, "%s", cmd)
+	if err := recordLoad(events, runScrapedLoad(c, dir, run, events, cmd, stdout, stderr)); err != nil {
+		return err
+	}
+	if after != nil {
+		after(events)
+	}
+	return nil
+}
+
+// freshCluster returns a prepare function for executeRun which wipes and
+// starts the cluster before every run.
+func freshCluster(c *cluster) func(*eventLog) error {
+	return func(events *eventLog) error {
+		events.record("wipe", "")
+		c.wipe()
+		events.record("start", "")
+		c.start()
+		return nil
+	}
+}
+
+// kvRun runs the repetitions of the test at the specified parameters and
+// concurrency which haven't already been run.
+func kvRun(c *cluster, dir string, m *testMetadata, params string, concurrency int) error {
+	for i := 1; i <= repeat; i++ {
+		runName := testRunName(params, concurrency, i)
 		if run, err := loadTestRun(dir, runName); err == nil && run != nil {
 			continue
 		}
 
-		err := func() error {
-			f, err := os.Create(filepath.Join(dir, runName))
-			if err != nil {
-				log.Fatal(err)
+		prepare := func(events *eventLog) error {
+			var load func() error
+			if m.Load != "" {
+				load = func() error {
+					return loadData(c, dir, runName, m, events)
+				}
 			}
-			defer f.Close()
-			c.wipe()
-			c.start()
-			cmd := fmt.Sprintf(m.Test, concurrency)
-			stdout := io.MultiWriter(f, os.Stdout)
-			stderr := io.MultiWriter(f, os.Stderr)
-			return c.runLoad(cmd, stdout, stderr)
-		}()
-		if err != nil {
-			if !isSigKill(err) {
-				fmt.Printf("%s\n", err)
+			if err := runData.prepare(c, events, load); err != nil {
+				return err
 			}
-			break
+			return rampLoad(c, dir, runName, m, params, concurrency, events)
+		}
+		loaded := func(events *eventLog) {
+			runData.loaded(c, events)
+		}
+		cmd := fmt.Sprintf(m.Test, concurrency) + paramFlags(params)
+		if err := executeRun(c, dir, runName, cmd, prepare, loaded); err != nil {
+			return err
 		}
 	}
-	c.stop()
+	return nil
+}
+
+func kv0(clusterName, dir string) error {
+	return kvTest(clusterName, "kv_0", dir, "", "./kv --read-percent=0 --splits=1000")
 }
 
-func kv0(clusterName, dir string) {
-	kvTest(clusterName, "kv_0", dir, "./kv --read-percent=0 --splits=1000")
+func kv95(clusterName, dir string) error {
+	return kvTest(clusterName, "kv_95", dir, "", "./kv --read-percent=95 --splits=1000")
 }
 
-func kv95(clusterName, dir string) {
-	kvTest(clusterName, "kv_95", dir, "./kv --read-percent=95 --splits=1000")
+// The flags separating the load phase of the ycsb tests from their runs. The
+// load phase only inserts the initial rows, without performing any operations
+// of the workload. The runs keep the loaded table and use its rows as their
+// keyspace without inserting them again, so that no insertion is measured.
+const (
+	ycsbLoadFlags = "--initial-load=%d --load-only"
+	ycsbRunFlags  = "--drop=false --initial-load=0 --record-count=%d"
+)
+
+func ycsbA(clusterName, dir string) error {
+	return kvTest(clusterName, "ycsb_a", dir,
+		"./ycsb --workload=A --splits=1000 --cassandra-replication=3 "+ycsbLoadFlags,
+		"./ycsb --workload=A --cassandra-replication=3 "+ycsbRunFlags)
 }
 
-func ycsbA(clusterName, dir string) {
-	kvTest(clusterName, "ycsb_a", dir, "./ycsb --workload=A --splits=1000 --cassandra-replication=3")
+func ycsbB(clusterName, dir string) error {
+	return kvTest(clusterName, "ycsb_b", dir,
+		"./ycsb --workload=B --splits=1000 --cassandra-replication=3 "+ycsbLoadFlags,
+		"./ycsb --workload=B --cassandra-replication=3 "+ycsbRunFlags)
 }
 
-func ycsbB(clusterName, dir string) {
-	kvTest(clusterName, "ycsb_b", dir, "./ycsb --workload=B --splits=1000 --cassandra-replication=3")
+func ycsbC(clusterName, dir string) error {
+	return kvTest(clusterName, "ycsb_c", dir,
+		"./ycsb --workload=C --splits=1000 --cassandra-replication=3 "+ycsbLoadFlags,
+		"./ycsb --workload=C --cassandra-replication=3 "+ycsbRunFlags)
 }
 
-func ycsbC(clusterName, dir string) {
-	kvTest(clusterName, "ycsb_c", dir, "./ycsb --workload=C --splits=1000 --cassandra-replication=3")
+var nightlyRuns = []struct {
+	name string
+	cmd  string
+}{
+	{"kv_0", "./kv --read-percent=0 --splits=1000 --concurrency=384 --duration=10m"},
+	{"kv_95", "./kv --read-percent=95 --splits=1000 --concurrency=384 --duration=10m"},
+	// TODO(tamird/petermattis): this configuration has been observed to hang
+	// indefinitely. Re-enable when it is more reliable.
+	//
+	// {"splits", "./kv --read-percent=0 --splits=100000 --concurrency=384 --max-ops=1"},
+}
+
+func isNightlyRun(name string) bool {
+	for _, r := range nightlyRuns {
+		if r.name == name {
+			return true
+		}
+	}
+	return false
 }
 
-func nightly(clusterName, dir string) {
+func nightly(clusterName, dir string) error {
 	var existing *testMetadata
 	if dir != "" {
 		existing = &testMetadata{}
@@ -420,74 +773,41 @@ func nightly(clusterName, dir string) {
 		}
 		clusterName = existing.Cluster
 		nodeArgs = existing.Args
-	}
-
-	cmds := []struct {
-		name string
-		cmd  string
-	}{
-		{"kv_0", "./kv --read-percent=0 --splits=1000 --concurrency=384 --duration=10m"},
-		{"kv_95", "./kv --read-percent=95 --splits=1000 --concurrency=384 --duration=10m"},
-		// TODO(tamird/petermattis): this configuration has been observed to hang
-		// indefinitely. Re-enable when it is more reliable.
-		//
-		// {"splits", "./kv --read-percent=0 --splits=100000 --concurrency=384 --max-ops=1"},
+		useHAProxy = existing.HAProxy
+		cassandraRecordedConfig = existing.CassandraConfig
+		chaosSpecs = existing.Chaos
 	}
 
 	c := testCluster(clusterName)
-	m := testMetadata{
-		Bin:     clusterVersion(c),
-		Cluster: c.name,
-		Nodes:   c.nodes,
-		Env:     c.env,
-		Args:    c.args,
-		Test:    "nightly",
-		Date:    time.Now().Format("2006-01-02T15_04_05"),
-	}
+	m := newTestMetadata(c, "nightly")
 	if existing == nil {
 		dir = testDir("nightly", m.Bin)
 		saveJSON(filepath.Join(dir, "metadata"), m)
 	} else {
-		if m.Bin != existing.Bin {
-			if err := putBin(c, dir); err != nil {
-				log.Fatalf("cockroach binary changed: %s != %s\n%s", m.Bin, existing.Bin, err)
-			}
-		}
+		restoreBin(c, dir, &m, existing)
 		m.Nodes = existing.Nodes
 		m.Env = existing.Env
 	}
 	fmt.Printf("%s: %s\n", c.name, dir)
+	registerResult(dir)
 	getBin(c, dir)
 
-	for _, cmd := range cmds {
+	for _, cmd := range nightlyRuns {
 		runName := fmt.Sprint(cmd.name)
 		if run, err := loadTestRun(dir, runName); err == nil && run != nil {
 			continue
 		}
 
-		err := func() error {
-			f, err := os.Create(filepath.Join(dir, runName))
-			if err != nil {
-				log.Fatal(err)
-			}
-			defer f.Close()
-			c.wipe()
-			c.start()
-			stdout := io.MultiWriter(f, os.Stdout)
-			stderr := io.MultiWriter(f, os.Stderr)
-			return c.runLoad(cmd.cmd, stdout, stderr)
-		}()
-		if err != nil {
-			if !isSigKill(err) {
-				fmt.Printf("%s\n", err)
-			}
-			break
+		if err := executeRun(c, dir, runName, cmd.cmd, freshCluster(c), nil); err != nil {
+			c.stop()
+			return err
 		}
 	}
 	c.stop()
+	return nil
 }
 
-func splits(clusterName, dir string) {
+func splits(clusterName, dir string) error {
 	var existing *testMetadata
 	if dir != "" {
 		existing = &testMetadata{}
@@ -496,32 +816,24 @@ func splits(clusterName, dir string) {
 		}
 		clusterName = existing.Cluster
 		nodeArgs = existing.Args
+		useHAProxy = existing.HAProxy
+		cassandraRecordedConfig = existing.CassandraConfig
+		chaosSpecs = existing.Chaos
 	}
 
 	const cmd = "./kv --splits=500000 --concurrency=384 --max-ops=1"
 	c := testCluster(clusterName)
-	m := testMetadata{
-		Bin:     clusterVersion(c),
-		Cluster: c.name,
-		Nodes:   c.nodes,
-		Env:     c.env,
-		Args:    c.args,
-		Test:    "splits",
-		Date:    time.Now().Format("2006-01-02T15_04_05"),
-	}
+	m := newTestMetadata(c, "splits")
 	if existing == nil {
 		dir = testDir("splits", m.Bin)
 		saveJSON(filepath.Join(dir, "metadata"), m)
 	} else {
-		if m.Bin != existing.Bin {
-			if err := putBin(c, dir); err != nil {
-				log.Fatalf("cockroach binary changed: %s != %s\n%s", m.Bin, existing.Bin, err)
-			}
-		}
+		restoreBin(c, dir, &m, existing)
 		m.Nodes = existing.Nodes
 		m.Env = existing.Env
 	}
 	fmt.Printf("%s: %s\n", c.name, dir)
+	registerResult(dir)
 	getBin(c, dir)
 
 	for i := 1; i <= 100; i++ {
@@ -530,28 +842,15 @@ func splits(clusterName, dir string) {
 			continue
 		}
 
-		err := func() error {
-			f, err := os.Create(filepath.Join(dir, runName))
-			if err != nil {
-				log.Fatal(err)
-			}
-			defer f.Close()
-			c.wipe()
-			c.start()
-			stdout := io.MultiWriter(f, os.Stdout)
-			stderr := io.MultiWriter(f, os.Stderr)
-			if err := c.runLoad(cmd, stdout, stderr); err != nil {
-				return err
-			}
+		stop := func(events *eventLog) {
+			events.record("stop", "")
 			c.stop()
-			return nil
-		}()
-		if err != nil {
-			if !isSigKill(err) {
-				fmt.Printf("%s\n", err)
-			}
-			break
+		}
+		if err := executeRun(c, dir, runName, cmd, freshCluster(c), stop); err != nil {
+			c.stop()
+			return err
 		}
 	}
 	c.stop()
+	return nil
 }
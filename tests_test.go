@@ -0,0 +1,55 @@
+package main
+
+import "testing"
+
+func TestParseTestRunName(t *testing.T) {
+	testCases := []struct {
+		name        string
+		params      string
+		concurrency int
+		ok          bool
+	}{
+		{"64", "", 64, true},
+		{"64.2", "", 64, true},
+		{"read-percent=95_64", "read-percent=95", 64, true},
+		{"read-percent=95_64.2", "read-percent=95", 64, true},
+		{"read-percent=95,batch=10_8", "read-percent=95,batch=10", 8, true},
+		{"x=0.5_64", "x=0.5", 64, true},
+		// The files recorded alongside each run are not runs.
+		{"64.events", "", 0, false},
+		{"64.ramp", "", 0, false},
+		{"64.load", "", 0, false},
+		{"64.metrics", "", 0, false},
+		{"x=0.5_64.events", "", 0, false},
+		{"read-percent=95_64.2.metrics", "", 0, false},
+		// Named runs, such as those of the nightly test, and other files.
+		{"kv_0", "", 0, false},
+		{"kv_95", "", 0, false},
+		{"metadata", "", 0, false},
+		{"64.2.3", "", 0, false},
+		{"x=1_", "", 0, false},
+		{"", "", 0, false},
+	}
+	for _, c := range testCases {
+		params, concurrency, ok := parseTestRunName(c.name)
+		if params != c.params || concurrency != c.concurrency || ok != c.ok {
+			t.Errorf("%q: expected (%q, %d, %t), got (%q, %d, %t)",
+				c.name, c.params, c.concurrency, c.ok, params, concurrency, ok)
+		}
+	}
+
+	// Run names round trip.
+	for _, c := range []struct {
+		params              string
+		concurrency, repeat int
+	}{
+		{"", 64, 1}, {"", 64, 3}, {"read-percent=95", 8, 1}, {"x=0.5,y=2", 8, 2},
+	} {
+		name := testRunName(c.params, c.concurrency, c.repeat)
+		params, concurrency, ok := parseTestRunName(name)
+		if !ok || params != c.params || concurrency != c.concurrency {
+			t.Errorf("%q: expected (%q, %d), got (%q, %d, %t)",
+				name, c.params, c.concurrency, params, concurrency, ok)
+		}
+	}
+}
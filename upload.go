@@ -2,20 +2,31 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pkg/errors"
 )
 
 const (
 	awsAccessKeyIDKey     = "AWS_ACCESS_KEY_ID"
 	awsSecretAccessKeyKey = "AWS_SECRET_ACCESS_KEY"
+
+	s3Bucket = "cockroachlabs"
+	s3Prefix = "roachperf/"
 )
 
+// s3Cache is the directory uploaded test archives are downloaded to.
+var s3Cache = "${HOME}/.roachperf/s3"
+
 func upload(args []string) error {
 	backend := "s3"
 	switch n := len(args); n {
@@ -50,7 +61,7 @@ func upload(args []string) error {
 	}
 	svc := s3.New(sess)
 
-	bucketName := "cockroachlabs"
+	bucketName := s3Bucket
 
 	tarpath := testdir + ".tgz"
 	cmd := exec.Command("tar", "-czf", tarpath, testdir)
@@ -63,7 +74,7 @@ func upload(args []string) error {
 		log.Fatalf("os.Open(%s): %s", tarpath, err)
 	}
 
-	key := "roachperf/" + tarpath
+	key := s3Prefix + tarpath
 
 	putObjectInput := s3.PutObjectInput{
 		Bucket: &bucketName,
@@ -84,3 +95,77 @@ func upload(args []string) error {
 	}
 	return nil
 }
+
+// downloadS3 downloads and extracts the uploaded test archives which haven't
+// already been downloaded into s3Cache, returning the directory containing
+// the tests.
+func downloadS3() (string, error) {
+	dir := os.ExpandEnv(s3Cache)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	sess, err := session.NewSession(&aws.Config{
+		Region: aws.String("us-east-1"),
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "AWS session")
+	}
+	svc := s3.New(sess)
+
+	var keys []string
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(s3Bucket),
+		Prefix: aws.String(s3Prefix),
+	}
+	if err := svc.ListObjectsV2Pages(input, func(page *s3.ListObjectsV2Output, last bool) bool {
+		for _, obj := range page.Contents {
+			if strings.HasSuffix(*obj.Key, ".tgz") {
+				keys = append(keys, *obj.Key)
+			}
+		}
+		return true
+	}); err != nil {
+		return "", errors.Wrap(err, "s3 list")
+	}
+
+	for _, key := range keys {
+		tarpath := filepath.Join(dir, path.Base(key))
+		if _, err := os.Stat(tarpath); err == nil {
+			continue
+		}
+		fmt.Printf("Downloading %s/%s\n", s3Bucket, key)
+		obj, err := svc.GetObject(&s3.GetObjectInput{
+			Bucket: aws.String(s3Bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			return "", errors.Wrapf(err, "s3 download %s", key)
+		}
+		err = func() error {
+			defer obj.Body.Close()
+			// Download to a temporary file so that an interrupted download is
+			// retried.
+			f, err := os.Create(tarpath + ".tmp")
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(f, obj.Body); err != nil {
+				_ = f.Close()
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+			cmd := exec.Command("tar", "-xzf", tarpath+".tmp", "-C", dir)
+			if out, err := cmd.CombinedOutput(); err != nil {
+				return errors.Wrapf(err, "%s: %s", cmd.Args, out)
+			}
+			return os.Rename(tarpath+".tmp", tarpath)
+		}()
+		if err != nil {
+			return "", err
+		}
+	}
+	return dir, nil
+}
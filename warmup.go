@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// warmup is the period at the start of each run which is excluded from the
+// results. The load runs for --duration after the warm-up. ramp is the period
+// before each run over which the concurrency is ramped up (see rampLoad).
+var warmup time.Duration
+var ramp time.Duration
+
+// rampStages is the number of stages of increasing concurrency run during the
+// ramp.
+const rampStages = 4
+
+// The events bracketing the ramp of a run.
+const (
+	rampEvent   = "ramp"
+	rampedEvent = "ramped"
+)
+
+// excluded returns the warm-up and ramp periods recorded in the metadata.
+func (m *testMetadata) excluded() (warmup, ramp time.Duration) {
+	warmup, _ = time.ParseDuration(m.Warmup)
+	ramp, _ = time.ParseDuration(m.Ramp)
+	return warmup, ramp
+}
+
+// measureStart returns the elapsed time (in seconds) within each run at which
+// the measurement starts. The ramp precedes the run, so only the warm-up is
+// excluded from the run.
+func (m *testMetadata) measureStart() float64 {
+	warmup, _ := m.excluded()
+	return warmup.Seconds()
+}
+
+// rampLoad ramps up the load before the measured load of a run by running the
+// load at increasing fractions of the concurrency, each for an equal part of
+// the ramp. The load generators have no ramp of their own, so each stage is a
+// separate invocation whose --duration overrides that of the test. The output
+// of the stages is written to <run>.ramp.
+func rampLoad(
+	c *cluster, dir, run string, m *testMetadata, params string, concurrency int, events *eventLog,
+) error {
+	_, ramp := m.excluded()
+	if ramp <= 0 {
+		return nil
+	}
+	f, err := os.Create(filepath.Join(dir, run+".ramp"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	stdout := io.MultiWriter(f, os.Stdout)
+	stderr := io.MultiWriter(f, os.Stderr)
+	events.record(rampEvent, "%s in %d stages", ramp, rampStages)
+	for i := 1; i <= rampStages; i++ {
+		n := concurrency * i / (rampStages + 1)
+		if n < 1 {
+			n = 1
+		}
+		cmd := fmt.Sprintf(m.Test, n) + paramFlags(params) +
+			fmt.Sprintf(" --duration=%s", ramp/rampStages)
+		if err := c.runLoad(cmd, stdout, stderr); err != nil {
+			events.record("error", "%s", err)
+			return err
+		}
+	}
+	events.record(rampedEvent, "")
+	return nil
+}
+
+// loadMeasuredRun loads a run, excluding the intervals and node metrics before
+// start (in seconds) from its results. It returns nil if the run is incomplete
+// or ended before start.
+func loadMeasuredRun(dir, name string, start float64) (*testRun, error) {
+	r, err := loadTestRun(dir, name)
+	if err != nil || r == nil {
+		return r, err
+	}
+	if start > 0 {
+		intervals, err := loadRunIntervals(dir, name)
+		if err != nil {
+			return nil, err
+		}
+		if !measureRun(r, intervals, start) {
+			return nil, nil
+		}
+	}
+	samples, err := loadRunMetrics(dir, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(samples) > 0 {
+		r.Metrics = summarizeMetrics(samples, start)
+	}
+	return r, nil
+}
+
+// measureRun recomputes the results of a run from the intervals after start,
+// as the summary of the load generator is cumulative over the whole run. The
+// throughput and errors are exact. The latency percentiles are approximated
+// by the mean of the interval percentiles weighted by the operations in each
+// interval, and the average latency is derived from the concurrency and
+// throughput (Little's law). Runs without intervals are left unchanged. It
+// returns false if no intervals follow start.
+func measureRun(r *testRun, intervals []runInterval, start float64) bool {
+	if len(intervals) == 0 {
+		return true
+	}
+	var begin, prev float64
+	var errStart int64
+	var ops, p50, p95, p99 float64
+	var last *runInterval
+	for i := range intervals {
+		iv := &intervals[i]
+		d := iv.Elapsed - prev
+		prev = iv.Elapsed
+		if iv.Elapsed <= start {
+			begin = iv.Elapsed
+			errStart = iv.Errors
+			continue
+		}
+		n := iv.OpsSec * d
+		ops += n
+		p50 += iv.P50Lat * n
+		p95 += iv.P95Lat * n
+		p99 += iv.P99Lat * n
+		last = iv
+	}
+	if last == nil || last.Elapsed <= begin {
+		return false
+	}
+
+	r.Elapsed = last.Elapsed - begin
+	r.Errors = last.Errors - errStart
+	r.Ops = int64(ops + 0.5)
+	r.OpsSec = ops / r.Elapsed
+	if ops > 0 {
+		r.P50Lat = p50 / ops
+		r.P95Lat = p95 / ops
+		r.P99Lat = p99 / ops
+	}
+	if r.Concurrency > 0 && r.OpsSec > 0 {
+		r.AvgLat = 1000 * float64(r.Concurrency) / r.OpsSec
+	}
+	r.Approximate = true
+	return true
+}
+
+// approximateNote describes how the latencies of the runs were approximated,
+// or returns "" if none of them were.
+func approximateNote(runs []*testRun) string {
+	for _, r := range runs {
+		if r.Approximate {
+			return "latencies after the warm-up are approximate: the percentiles are the " +
+				"ops-weighted means of the interval percentiles and avg is concurrency/throughput"
+		}
+	}
+	return ""
+}
+
+// loadMetadataMeasureStart returns the measurement start recorded in the
+// metadata of the test directory.
+func loadMetadataMeasureStart(dir string) (float64, error) {
+	var m testMetadata
+	if err := loadJSON(filepath.Join(dir, "metadata"), &m); err != nil {
+		return 0, err
+	}
+	return m.measureStart(), nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadRunIntervals(t *testing.T) {
+	dir, err := ioutil.TempDir("", "roachperf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	const header = "_elapsed___errors__ops/sec(inst)___ops/sec(cum)__p50(ms)__p95(ms)__p99(ms)_pMax(ms)\n"
+	testCases := []struct {
+		output   string
+		expected []runInterval
+	}{
+		{"", nil},
+		{"error: connection refused\n", nil},
+		// The interval header is repeated and the intervals end at the summary.
+		{header +
+			"      1s        0          100.0          100.0      1.0      2.0      3.0      4.0\n" +
+			"      2s        1          200.0          150.0      2.0      3.0      4.0      5.0\n" +
+			header +
+			"      3s        3          300.0          200.0      3.0      4.0      5.0      6.0\n" +
+			"\n" +
+			"_elapsed___errors_____ops(total)___ops/sec(cum)__avg(ms)__p50(ms)__p95(ms)__p99(ms)_pMax(ms)\n" +
+			"    3.0s        3            600          200.0      2.0      2.0      3.0      4.0      6.0\n",
+			[]runInterval{
+				{1, 0, 100, 100, 1, 2, 3, 4},
+				{2, 1, 200, 150, 2, 3, 4, 5},
+				{3, 3, 300, 200, 3, 4, 5, 6},
+			}},
+	}
+	for i, c := range testCases {
+		if err := ioutil.WriteFile(filepath.Join(dir, "run"), []byte(c.output), 0644); err != nil {
+			t.Fatal(err)
+		}
+		intervals, err := loadRunIntervals(dir, "run")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(intervals, c.expected) {
+			t.Errorf("%d: expected %v, got %v", i, c.expected, intervals)
+		}
+	}
+}
+
+func TestMeasureRun(t *testing.T) {
+	intervals := []runInterval{
+		{Elapsed: 1, Errors: 0, OpsSec: 100, P50Lat: 1, P95Lat: 1, P99Lat: 1},
+		{Elapsed: 2, Errors: 1, OpsSec: 200, P50Lat: 2, P95Lat: 2, P99Lat: 2},
+		{Elapsed: 3, Errors: 3, OpsSec: 300, P50Lat: 3, P95Lat: 3, P99Lat: 3},
+		{Elapsed: 4, Errors: 6, OpsSec: 400, P50Lat: 4, P95Lat: 4, P99Lat: 4},
+	}
+	newRun := func() *testRun {
+		return &testRun{Concurrency: 10, Elapsed: 4, Ops: 1000, OpsSec: 250, AvgLat: 1, P99Lat: 4}
+	}
+
+	// Runs without intervals are left unchanged.
+	r := newRun()
+	if !measureRun(r, nil, 2) || !reflect.DeepEqual(r, newRun()) {
+		t.Errorf("no intervals: expected the run to be unchanged, got %+v", r)
+	}
+
+	testCases := []struct {
+		start         float64
+		elapsed       float64
+		errors, ops   int64
+		opsSec, p99   float64
+		expectMeasure bool
+	}{
+		// The interval ending at start is excluded.
+		{2, 2, 5, 700, 350, 2500.0 / 700, true},
+		{2.5, 2, 5, 700, 350, 2500.0 / 700, true},
+		{0.5, 4, 6, 1000, 250, 3000.0 / 1000, true},
+		{3.5, 1, 3, 400, 400, 4, true},
+		// No intervals follow start.
+		{4, 0, 0, 0, 0, 0, false},
+		{10, 0, 0, 0, 0, 0, false},
+	}
+	for _, c := range testCases {
+		r := newRun()
+		if measured := measureRun(r, intervals, c.start); measured != c.expectMeasure {
+			t.Errorf("start=%g: expected %t, got %t", c.start, c.expectMeasure, measured)
+			continue
+		}
+		if !c.expectMeasure {
+			continue
+		}
+		if r.Elapsed != c.elapsed || r.Errors != c.errors || r.Ops != c.ops ||
+			math.Abs(r.OpsSec-c.opsSec) > 1e-9 || math.Abs(r.P99Lat-c.p99) > 1e-9 {
+			t.Errorf("start=%g: unexpected run %+v", c.start, r)
+		}
+		// Little's law: concurrency / throughput.
+		if e := 1000 * 10 / c.opsSec; math.Abs(r.AvgLat-e) > 1e-9 {
+			t.Errorf("start=%g: expected avg %g, got %g", c.start, e, r.AvgLat)
+		}
+		if !r.Approximate {
+			t.Errorf("start=%g: expected the run to be approximate", c.start)
+		}
+	}
+}
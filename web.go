@@ -3,57 +3,139 @@ package main
 import (
 	"fmt"
 	"html/template"
+	"io"
 	"io/ioutil"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
 )
 
+// webCompare forces more than two tests to be compared rather than displayed
+// in the bulk overview.
+var webCompare bool
+
+// webOutput is the file to write the results to. The file is self-contained
+// and can be viewed without network access.
+var webOutput string
+
+// webHistory is a directory containing previous tests, or "s3" for the tests
+// uploaded to S3, to include in the overview.
+var webHistory string
+
+// webServeAddr is the address to serve results on. If empty, the results are
+// written to a temporary file which is opened in the browser.
+var webServeAddr string
+
 func web(dirs []string) error {
-	// TODO(peter): visualize the output of a single test run, showing
-	// performance and latency over time.
-	switch n := len(dirs); n {
-	case 0:
-		return fmt.Errorf("no test directory specified")
-	case 1, 2:
-		d1, err := loadTestData(dirs[0])
+	if webServeAddr != "" {
+		return webServe(webServeAddr, dirs)
+	}
+	if webHistory != "" {
+		history, err := historyDirs(webHistory)
 		if err != nil {
 			return err
 		}
-		if n == 1 {
-			return web1(d1)
+		dirs = append(dirs, history...)
+	}
+	if len(dirs) == 0 {
+		return fmt.Errorf("no test directory specified")
+	}
+
+	render := func(w io.Writer) error {
+		switch {
+		case webRunName != "":
+			return webRun(w, dirs, webRunName)
+		case webHistory != "":
+			return webBulk(w, dirs)
 		}
-		d2, err := loadTestData(dirs[1])
+		return webRender(w, dirs, webCompare, compareBaseline)
+	}
+	if webOutput != "" {
+		f, err := os.Create(webOutput)
 		if err != nil {
 			return err
 		}
-		return web2(d1, d2)
-	default:
-		ds := make([]*testData, len(dirs))
-		for i, dir := range dirs {
-			d, err := loadTestData(dir)
-			if err != nil {
-				return err
-			}
-
-			ds[i] = d
+		if err := render(f); err != nil {
+			_ = f.Close()
+			return err
 		}
-		return webBulk(ds)
+		return f.Close()
 	}
-}
 
-func webApply(m interface{}) error {
-	t, err := template.New("web").Parse(webHTML)
+	f, err := ioutil.TempFile("", "web")
 	if err != nil {
 		return err
 	}
-	f, err := ioutil.TempFile("", "web")
+	defer f.Close()
+	if err := render(f); err != nil {
+		return err
+	}
+	return openBrowser(f.Name())
+}
+
+// webRender renders a single test, a comparison of tests or, if there are more
+// than two tests and compare is false, an overview of the tests.
+func webRender(w io.Writer, dirs []string, compare bool, baseline int) error {
+	if len(dirs) > 2 && !compare {
+		return webBulk(w, dirs)
+	}
+
+	ds, err := loadCompareData(dirs, baseline)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-	if err := t.Execute(f, m); err != nil {
+	if len(ds) == 1 {
+		return web1(w, ds[0])
+	}
+	return webN(w, ds)
+}
+
+// historyDirs returns the test directories in the specified directory, or
+// the tests uploaded to S3 if dir is "s3".
+func historyDirs(dir string) ([]string, error) {
+	if dir == "s3" {
+		var err error
+		if dir, err = downloadS3(); err != nil {
+			return nil, err
+		}
+	}
+	ents, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var dirs []string
+	for _, e := range ents {
+		path := filepath.Join(dir, e.Name())
+		if _, err := os.Stat(filepath.Join(path, "metadata")); e.IsDir() && err == nil {
+			dirs = append(dirs, path)
+		}
+	}
+	return dirs, nil
+}
+
+func openBrowser(path string) error {
+	cmd := "open"
+	if runtime.GOOS == "linux" {
+		cmd = "xdg-open"
+	}
+	return exec.Command(cmd, path).Run()
+}
+
+func webApply(w io.Writer, m interface{}) error {
+	t, err := template.New("web").Parse(webHTML)
+	if err != nil {
 		return err
 	}
-	return exec.Command("open", f.Name()).Run()
+	return t.Execute(w, m)
+}
+
+// webTable is a table displayed below the chart.
+type webTable struct {
+	Header []string
+	Rows   [][]string
+	Footer string
 }
 
 type series struct {
@@ -62,13 +144,23 @@ type series struct {
 	LineDashStyle   []int
 }
 
-func web1(d *testData) error {
+// webRunX returns the x value of a run on a chart: the concurrency, or for a
+// run with swept parameters, its name. Runs with parameters are thus displayed
+// on a categorical axis.
+func webRunX(r *testRun) interface{} {
+	if r.Params != "" {
+		return r.key()
+	}
+	return r.Concurrency
+}
+
+func web1(w io.Writer, d *testData) error {
 	data := []interface{}{
 		[]interface{}{"concurrency", "ops/sec", "avg latency", "99%-tile latency"},
 	}
 	for _, r := range d.Runs {
 		data = append(data, []interface{}{
-			r.Concurrency, r.OpsSec, r.AvgLat, r.P99Lat,
+			webRunX(r), r.OpsSec, r.AvgLat, r.P99Lat,
 		})
 	}
 
@@ -82,57 +174,113 @@ func web1(d *testData) error {
 			{1, "#ff0000", []int{4, 4}},
 		},
 	}
+	if names := metricsHeader(d.Runs); len(names) > 0 {
+		table := webTable{Header: append([]string{"run"}, names...)}
+		for _, r := range d.Runs {
+			table.Rows = append(table.Rows, append([]string{r.key()}, metricsRecord(r, names)...))
+		}
+		table.Footer = "node metrics: gauges are averaged over the run, counters are the increase during the run"
+		m["table"] = table
+	}
+	var notes []string
+	if d.Load != nil {
+		notes = append(notes, formatLoad(d.Load))
+	}
+	if note := approximateNote(d.Runs); note != "" {
+		notes = append(notes, note)
+	}
+	m["notes"] = notes
 
-	return webApply(m)
+	return webApply(w, m)
 }
 
-func web2(d1, d2 *testData) error {
-	d1, d2 = alignTestData(d1, d2)
+// webColors are the colors of the tests in a comparison. Tests beyond the
+// number of colors reuse them.
+var webColors = []string{
+	"#ff0000", "#0000ff", "#008000", "#ff8c00",
+	"#800080", "#00a0a0", "#8b4513", "#ff1493",
+}
 
-	data := []interface{}{
-		[]interface{}{
-			"concurrency",
-			fmt.Sprintf("ops/sec (%s)", d1.Metadata.Bin),
-			fmt.Sprintf("99%%-lat (%s)", d1.Metadata.Bin),
-			fmt.Sprintf("ops/sec (%s)", d2.Metadata.Bin),
-			fmt.Sprintf("99%%-lat (%s)", d2.Metadata.Bin),
+// webN compares the tests, the first of which is the baseline.
+func webN(w io.Writer, ds []*testData) error {
+	ds = alignTestDataN(ds)
+
+	header := []interface{}{"concurrency"}
+	var s []series
+	for i, d := range ds {
+		header = append(header,
+			fmt.Sprintf("ops/sec (%s)", d.Metadata.Bin),
+			fmt.Sprintf("99%%-lat (%s)", d.Metadata.Bin))
+		color := webColors[i%len(webColors)]
+		s = append(s, series{0, color, []int{}}, series{1, color, []int{2, 2}})
+	}
+	data := []interface{}{header}
+	for i := range ds[0].Runs {
+		row := []interface{}{webRunX(ds[0].Runs[i])}
+		for _, d := range ds {
+			row = append(row, d.Runs[i].OpsSec, d.Runs[i].P99Lat)
+		}
+		data = append(data, row)
+	}
+
+	table := webTable{
+		Header: []string{
+			"metric", "run",
+			fmt.Sprintf("mean ± 95%%ci (%s)", ds[0].Metadata.Bin), "stddev",
 		},
 	}
-	for i := range d1.Runs {
-		r1 := d1.Runs[i]
-		r2 := d2.Runs[i]
-		data = append(data, []interface{}{
-			r1.Concurrency, r1.OpsSec, r1.P99Lat, r2.OpsSec, r2.P99Lat,
-		})
+	for _, d := range ds[1:] {
+		table.Header = append(table.Header,
+			fmt.Sprintf("mean ± 95%%ci (%s)", d.Metadata.Bin), "stddev",
+			"delta", "p-value")
+	}
+	for _, r := range compareTestDataN(ds) {
+		base := r.Comparisons[0].Base
+		row := []string{
+			r.Metric, r.Key,
+			formatStat(base.Mean) + " ± " + formatStat(base.CI),
+			formatStat(base.Stddev),
+		}
+		for _, c := range r.Comparisons[1:] {
+			var sig string
+			if c.Significant {
+				sig = " *"
+			}
+			row = append(row,
+				formatStat(c.New.Mean)+" ± "+formatStat(c.New.CI),
+				formatStat(c.New.Stddev),
+				formatPercent(c.Delta), formatP(c.P)+sig)
+		}
+		table.Rows = append(table.Rows, row)
 	}
+	table.Footer = fmt.Sprintf("* statistically significant compared to %s (p < %.2f, Welch's t-test)",
+		ds[0].Metadata.Bin, significanceLevel)
 
 	m := map[string]interface{}{
-		"data":  data,
-		"haxis": "concurrency",
-		"vaxes": []string{"ops/sec", "latency (ms)"},
-		"series": []series{
-			{0, "#ff0000", []int{}},
-			{1, "#ff0000", []int{2, 2}},
-			{0, "#0000ff", []int{}},
-			{1, "#0000ff", []int{2, 2}},
-		},
+		"data":   data,
+		"haxis":  "concurrency",
+		"vaxes":  []string{"ops/sec", "latency (ms)"},
+		"series": s,
+		"table":  table,
+	}
+	if note := approximateNote(allRuns(ds)); note != "" {
+		m["notes"] = []string{note}
 	}
-	return webApply(m)
+	return webApply(w, m)
 }
 
 const webHTML = `<html>
   <head>
-    <script type="text/javascript" src="https://www.gstatic.com/charts/loader.js"></script>
+    <script type="text/javascript">` + webChartJS + `</script>
     <script type="text/javascript">
-      google.charts.load('current', {'packages':['corechart']});
-      google.charts.setOnLoadCallback(drawChart);
+      window.onload = drawChart;
 
       function drawChart() {
-        var data = google.visualization.arrayToDataTable([
+        var data = [
           {{- range .data }}
           {{ . }},
           {{- end}}
-        ]);
+        ];
 
         var options = {
           legend: { position: 'top', alignment: 'center', textStyle: {fontSize: 12}, maxLines: 5 },
@@ -150,47 +298,142 @@ const webHTML = `<html>
           hAxis: {
             title: {{ .haxis }},
           },
+          markers: {{ .markers }},
         };
-        var chart = new google.visualization.LineChart(document.getElementById('chart'));
-        chart.draw(data, options);
+        webChart.draw(document.getElementById('chart'), data, options);
       }
     </script>
   </head>
   <body>
     <div id="chart" style="width: 800; height: 600"></div>
+    {{- range .notes }}
+    <p style="font-family: monospace">{{ . }}</p>
+    {{- end }}
+    {{- with .table }}
+    <table style="font-family: monospace; border-spacing: 12px 2px">
+      <tr>{{ range .Header }}<th>{{ . }}</th>{{ end }}</tr>
+      {{- range .Rows }}
+      <tr>{{ range . }}<td align="right">{{ . }}</td>{{ end }}</tr>
+      {{- end }}
+    </table>
+    <p>{{ .Footer }}</p>
+    {{- end }}
   </body>
 </html>
 `
 
-func webBulk(m []*testData) error {
+// webSummary is the run initially used to summarize each test in the
+// overview: "peak" or the key of a run (e.g. 64 or kv_95).
+var webSummary = "peak"
+
+// webBulkTest is a test displayed in the overview.
+type webBulkTest struct {
+	Name string
+	*testData
+	// Runs holds the runs of the test along with their keys.
+	Runs []webBulkRun
+}
+
+// webBulkRun is a run of a test displayed in the overview. Series identifies
+// the runs which are plotted against each other by concurrency: the name of a
+// named run or the swept parameters of a run. The peak throughput of each
+// series of a test is summarized separately.
+type webBulkRun struct {
+	*testRun
+	Key    string
+	Series string
+}
+
+func webBulk(w io.Writer, dirs []string) error {
 	t, err := template.New("web").Parse(webHTMLBulk)
 	if err != nil {
 		return err
 	}
-	f, err := ioutil.TempFile("", "web")
-	if err != nil {
-		return err
+
+	tests := make([]webBulkTest, len(dirs))
+	seen := map[string]bool{}
+	var keys []*testRun
+	for i, dir := range dirs {
+		d, err := loadTestData(dir)
+		if err != nil {
+			return err
+		}
+
+		tests[i] = webBulkTest{Name: testDirName(dir), testData: d}
+		for _, r := range d.Runs {
+			series := r.Name
+			if series == "" {
+				series = r.Params
+			}
+			tests[i].Runs = append(tests[i].Runs, webBulkRun{r, r.key(), series})
+			if !seen[r.key()] {
+				seen[r.key()] = true
+				keys = append(keys, r)
+			}
+		}
 	}
-	defer f.Close()
-	if err := t.Execute(f, m); err != nil {
-		return err
+	// The runs named by concurrency are listed first, followed by the named
+	// runs and the runs with swept parameters.
+	sort.SliceStable(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if (a.Name != "" || a.Params != "") != (b.Name != "" || b.Params != "") {
+			return a.Name == "" && a.Params == ""
+		}
+		if a.Name != b.Name || a.Params != b.Params {
+			return a.key() < b.key()
+		}
+		return a.Concurrency < b.Concurrency
+	})
+	summaries := make([]webSummaryOption, len(keys))
+	for i, r := range keys {
+		summaries[i] = webSummaryOption{Key: r.key(), Label: "run " + r.key()}
+		if r.Name == "" && r.Params == "" {
+			summaries[i].Label = "concurrency " + r.key()
+		}
 	}
-	return exec.Command("open", f.Name()).Run()
+
+	data := struct {
+		Tests              []webBulkTest
+		Colors             []string
+		Summary            string
+		Summaries          []webSummaryOption
+		MaxThroughputDrop  float64
+		MaxLatencyIncrease float64
+	}{tests, webColors, webSummary, summaries, checkMaxThroughputDrop, checkMaxLatencyIncrease}
+	return t.Execute(w, data)
+}
+
+// webSummaryOption is a run which can summarize each test in the overview.
+type webSummaryOption struct {
+	Key   string
+	Label string
 }
 
 const webHTMLBulk = `<html>
   <head>
   </head>
-    <script type="text/javascript" src="https://www.gstatic.com/charts/loader.js"></script>
+    <script type="text/javascript">` + webChartJS + `</script>
     <script>
-      google.charts.load('current', {'packages':['corechart']});
-      google.charts.setOnLoadCallback(renderOverview);
+      window.onload = renderOverview;
+
+      // The run summarizing each test in the overview: "peak" for the run with
+      // the highest throughput of each series, or the key of a run.
+      var SUMMARY = {{ .Summary }};
+
+      // The overview is sorted by "date" or "bin".
+      var SORT = "date";
 
-      var SUMMARY_CONCURRENCY = 384;
+      // A point in the overview is marked as a regression if it is worse than
+      // the mean of the preceding TREND_WINDOW points by more than the
+      // thresholds (percent).
+      var TREND_WINDOW = 5;
+      var MAX_THROUGHPUT_DROP = {{ .MaxThroughputDrop }};
+      var MAX_LATENCY_INCREASE = {{ .MaxLatencyIncrease }};
 
       var tests = [
-      {{- range $j, $d := . }}{{ if $j }},{{ end }}
+      {{- range $j, $d := .Tests }}{{ if $j }},{{ end }}
         {
+          "name": {{ .Name }},
           "metadata": {
             "bin": {{ .Metadata.Bin }},
             "cluster": {{ .Metadata.Cluster }},
@@ -203,6 +446,8 @@ const webHTMLBulk = `<html>
           "runs": [
           {{- range $i, $e := .Runs }}{{ if $i }},{{ end }}
             {
+              "key": {{ $e.Key }},
+              "series": {{ $e.Series }},
               "concurrency": {{ $e.Concurrency }},
               "elapsed": {{ $e.Elapsed }},
               "errors": {{ $e.Errors }},
@@ -219,20 +464,6 @@ const webHTMLBulk = `<html>
       {{- end }}
       ];
 
-      var summaryOptions = {
-        legend: { position: 'top', alignment: 'center', textStyle: {fontSize: 12}, maxLines: 5 },
-        crosshair: { trigger: 'both', opacity: 0.35 },
-        series: {
-          "0":{targetAxisIndex: 0, color:"#ff0000", lineDashStyle: []},
-          "1":{targetAxisIndex: 1, color:"#ff0000", lineDashStyle: [2, 2]},
-          "2":{targetAxisIndex: 1, color:"#ff0000", lineDashStyle: [4, 4]}
-        },
-        vAxes: {"0":{title:"ops/sec"}, "1":{title:"latency (ms)"}},
-        hAxis: {
-          title: "version",
-        },
-      };
-
       var oneTestOptions = {
         legend: { position: 'top', alignment: 'center', textStyle: {fontSize: 12}, maxLines: 5 },
         crosshair: { trigger: 'both', opacity: 0.35 },
@@ -247,47 +478,115 @@ const webHTMLBulk = `<html>
         },
       };
 
-      var twoTestOptions = {
-        legend: { position: 'top', alignment: 'center', textStyle: {fontSize: 12}, maxLines: 5 },
-        crosshair: { trigger: 'both', opacity: 0.35 },
-        series: {
-          "0":{targetAxisIndex: 0, color:"#ff0000", lineDashStyle: []},
-          "1":{targetAxisIndex: 1, color:"#ff0000", lineDashStyle: [2, 2]},
-          "2":{targetAxisIndex: 0, color:"#0000ff", lineDashStyle: []},
-          "3":{targetAxisIndex: 1, color:"#0000ff", lineDashStyle: [2, 2]}
-        },
-        vAxes: {"0":{title:"ops/sec"}, "1":{title:"latency (ms)"}},
-        hAxis: {
-          title: "concurrency",
-        },
-      };
+      var COLORS = [{{ range $i, $c := .Colors }}{{ if $i }}, {{ end }}{{ $c }}{{ end }}];
 
       var compare = [];
 
+      // summaryRuns returns the runs summarizing a test, keyed by series. The
+      // peak throughput is taken separately for each series as the runs of
+      // different series are different workloads.
+      function summaryRuns(t) {
+        var best = {};
+        t.runs.forEach(function (r) {
+          if (SUMMARY === "peak") {
+            if (!best[r.series] || r.opsSec > best[r.series].opsSec) best[r.series] = r;
+          } else if (r.key === SUMMARY) {
+            best[r.series] = r;
+          }
+        });
+        return best;
+      }
+
+      // runX returns the horizontal position of a run in a chart: its
+      // concurrency, or its key for named runs and runs with swept parameters.
+      function runX(r) {
+        return r.series ? r.key : r.concurrency;
+      }
+
+      // isRegression returns true if v is worse than the mean of prev by more
+      // than pct percent. If higher is true larger values are better.
+      function isRegression(v, prev, pct, higher) {
+        if (!prev.length) return false;
+        var mean = prev.reduce(function (a, b) { return a + b; }, 0) / prev.length;
+        var delta = 100 * (v - mean) / mean;
+        return (higher ? -delta : delta) > pct;
+      }
+
+      // renderOverview charts the trend of the summary run of the tests,
+      // grouped by test name and cluster.
       function renderOverview() {
-        var summary = tests
-          .map(function (t) {
-            return {
-              bin: t.metadata.bin,
-              runs: t.runs.filter(function (r) { return r.concurrency === SUMMARY_CONCURRENCY; })
-            };
-          })
-          .filter(function (t) { return t.runs.length; })
-          .map(function (t) { return { bin: t.bin, run: t.runs[0] }; });
-
-        var test;
-
-        var source = [["version", "ops/sec", "avg latency", "99%-ile latency"]];
-        for (var i = 0; i < summary.length; i++) {
-          test = summary[i];
-          source.push([test.bin, test.run.opsSec, test.run.avgLat, test.run.p99Lat]);
-        }
+        var groups = {}, keys = [];
+        tests.forEach(function (t) {
+          var runs = summaryRuns(t);
+          Object.keys(runs).forEach(function (series) {
+            var key = t.name + (series ? " " + series : "") + " on " + t.metadata.cluster;
+            if (!groups[key]) {
+              groups[key] = [];
+              keys.push(key);
+            }
+            groups[key].push({test: t, run: runs[series]});
+          });
+        });
+        keys.sort();
+
+        var container = document.getElementById('chart');
+        container.innerHTML = "";
+        keys.forEach(function (key) {
+          var points = groups[key].slice().sort(function (a, b) {
+            var x = SORT === "bin" ? a.test.metadata.bin : a.test.metadata.date;
+            var y = SORT === "bin" ? b.test.metadata.bin : b.test.metadata.date;
+            return x < y ? -1 : x > y ? 1 : 0;
+          });
+
+          var source = [[SORT === "bin" ? "version" : "date", "ops/sec", "avg latency", "99%-ile latency",
+            "throughput regression", "latency regression"]];
+          var regressions = 0;
+          points.forEach(function (p, i) {
+            var prev = points.slice(Math.max(0, i - TREND_WINDOW), i);
+            var ops = isRegression(p.run.opsSec, prev.map(function (q) { return q.run.opsSec; }), MAX_THROUGHPUT_DROP, true);
+            var lat = isRegression(p.run.p99Lat, prev.map(function (q) { return q.run.p99Lat; }), MAX_LATENCY_INCREASE, false);
+            if (ops || lat) regressions++;
+            var x = SORT === "bin" ? p.test.metadata.bin : p.test.metadata.date + " " + p.test.metadata.bin;
+            source.push([x, p.run.opsSec, p.run.avgLat, p.run.p99Lat,
+              ops ? p.run.opsSec : null, lat ? p.run.p99Lat : null]);
+          });
+
+          var title = document.createElement("h4");
+          if (regressions) {
+            key += " (" + regressions + (regressions === 1 ? " regression)" : " regressions)");
+          }
+          title.textContent = key;
+          container.appendChild(title);
+          var div = document.createElement("div");
+          div.setAttribute("style", "width: 800px; height: 400px");
+          container.appendChild(div);
+          webChart.draw(div, source, {
+            series: {
+              "0":{targetAxisIndex: 0, color:"#ff0000", lineDashStyle: []},
+              "1":{targetAxisIndex: 1, color:"#ff0000", lineDashStyle: [2, 2]},
+              "2":{targetAxisIndex: 1, color:"#ff0000", lineDashStyle: [4, 4]},
+              "3":{targetAxisIndex: 0, color:"#000000", lineWidth: 0, pointSize: 7},
+              "4":{targetAxisIndex: 1, color:"#000000", lineWidth: 0, pointSize: 7}
+            },
+            vAxes: {"0":{title:"ops/sec"}, "1":{title:"latency (ms)"}},
+            hAxis: {
+              title: SORT === "bin" ? "version" : "date",
+            },
+          });
+        });
+
+        var label = 'overview (' + (SUMMARY === "peak" ? "peak throughput" : "run " + SUMMARY) + ')';
+        document.getElementById("label").innerHTML = label;
+      }
 
-        var data = google.visualization.arrayToDataTable(source);
-        var chart = new google.visualization.LineChart(document.getElementById('chart'));
-        chart.draw(data, summaryOptions);
+      function setSummary(v) {
+        SUMMARY = v;
+        renderOverview();
+      }
 
-        document.getElementById("label").innerHTML = 'overview';
+      function setSort(v) {
+        SORT = v;
+        renderOverview();
       }
 
       function renderChart(i) {
@@ -298,66 +597,89 @@ const webHTMLBulk = `<html>
         var source = [["concurrency", "ops/sec", "avg latency", "99%-ile latency"]];
         for (var i = 0; i < runs.length; i++) {
           run = runs[i];
-          source.push([run.concurrency, run.opsSec, run.avgLat, run.p99Lat]);
+          source.push([runX(run), run.opsSec, run.avgLat, run.p99Lat]);
         }
 
-        var data = google.visualization.arrayToDataTable(source);
-        var chart = new google.visualization.LineChart(document.getElementById('chart'));
-        chart.draw(data, oneTestOptions);
+        webChart.draw(document.getElementById('chart'), source, oneTestOptions);
 
         document.getElementById("label").innerHTML = bin;
       }
 
       function compareChart(i) {
-        compare.push(i);
-
-        if (compare.length > 2) compare = compare.slice(compare.length - 2);
-
-        if (compare.length !== 2) return;
-
-        var d1 = tests[compare[0]], d2 = tests[compare[1]];
-        var bin1 = d1.metadata.bin, bin2 = d2.metadata.bin;
+        var j = compare.indexOf(i);
+        if (j >= 0) {
+          compare.splice(j, 1);
+        } else {
+          compare.push(i);
+        }
 
-        var byConcurrency1 = {}, byConcurrency2 = {};
+        if (compare.length < 2) return;
 
-        var concurrencies1 = d1.runs.map(function (r) {
-          byConcurrency1[r.concurrency] = r;
-          return r.concurrency;
-        });
-        var concurrencies2 = d2.runs.map(function (r) {
-          byConcurrency2[r.concurrency] = r;
-          return r.concurrency;
+        var selected = compare.map(function (k) { return tests[k]; });
+        var byKey = selected.map(function (d) {
+          var m = {};
+          d.runs.forEach(function (r) { m[r.key] = r; });
+          return m;
         });
 
-        var concurrencies = concurrencies1.filter(function (c) { return concurrencies2.indexOf(c) >= 0; });
-
-        var concurrency, run1, run2;
+        var common = selected[0].runs.filter(function (r) {
+          return byKey.every(function (m) { return m[r.key] !== undefined; });
+        });
 
-        var source = [["concurrency", "ops/sec (" + bin1 + ")", "99%-ile (" + bin1 + ")", "ops/sec (" + bin2 + ")", "99%-ile (" + bin2 + ")"]];
-        for (var i = 0; i < concurrencies.length; i++) {
-          concurrency = concurrencies[i];
-          run1 = byConcurrency1[concurrency];
-          run2 = byConcurrency2[concurrency];
+        var header = ["concurrency"];
+        var options = {
+          legend: { position: 'top', alignment: 'center', textStyle: {fontSize: 12}, maxLines: 5 },
+          crosshair: { trigger: 'both', opacity: 0.35 },
+          series: {},
+          vAxes: {"0":{title:"ops/sec"}, "1":{title:"latency (ms)"}},
+          hAxis: {
+            title: "concurrency",
+          },
+        };
+        selected.forEach(function (d, k) {
+          var color = COLORS[k % COLORS.length];
+          header.push("ops/sec (" + d.metadata.bin + ")", "99%-ile (" + d.metadata.bin + ")");
+          options.series[2*k] = {targetAxisIndex: 0, color: color, lineDashStyle: []};
+          options.series[2*k+1] = {targetAxisIndex: 1, color: color, lineDashStyle: [2, 2]};
+        });
 
-          source.push([concurrency, run1.opsSec, run1.p99Lat, run2.opsSec, run2.p99Lat]);
-        }
+        var source = [header];
+        common.forEach(function (r) {
+          var row = [runX(r)];
+          byKey.forEach(function (m) { row.push(m[r.key].opsSec, m[r.key].p99Lat); });
+          source.push(row);
+        });
 
-        var data = google.visualization.arrayToDataTable(source);
-        var chart = new google.visualization.LineChart(document.getElementById('chart'));
-        chart.draw(data, twoTestOptions);
+        webChart.draw(document.getElementById('chart'), source, options);
 
-        document.getElementById("label").innerHTML = bin1 + ' vs. ' + bin2;
+        document.getElementById("label").innerHTML = selected
+          .map(function (d) { return d.metadata.bin; })
+          .join(' vs. ');
       }
     </script>
   <body>
     <h2>performance review</h2>
-	<p>Chart a single test by clicking "single".  Compare two by clicking "compare" on each.</p>
+	<p>Chart a single test by clicking "single".  Compare two or more by clicking "compare" on each (click again to deselect).</p>
     <h3>available tests</h3>
+    <p>
+      Summarize each test by
+      <select onChange="setSummary(this.value);">
+        <option value="peak"{{ if eq .Summary "peak" }} selected{{ end }}>peak throughput</option>
+        {{- range .Summaries }}
+        <option value="{{ .Key }}"{{ if eq $.Summary .Key }} selected{{ end }}>{{ .Label }}</option>
+        {{- end }}
+      </select>
+      sorted by
+      <select onChange="setSort(this.value);">
+        <option value="date">date</option>
+        <option value="bin">binary</option>
+      </select>
+    </p>
     <ul>
       <li><a href="#" onClick="renderOverview()">overview</a></li>
-    {{- range $i, $e := . }}
+    {{- range $i, $e := .Tests }}
       <li>
-        {{ .Metadata.Bin }}
+        {{ .Name }} {{ .Metadata.Bin }}
         {{- if .Metadata.Date }} ({{ .Metadata.Date }}){{ end }}
         - <a href="#" onClick="renderChart({{ $i }});">single</a>
         - <a href="#" onClick="compareChart({{ $i }});">compare</a>
@@ -365,7 +687,7 @@ const webHTMLBulk = `<html>
     {{- end }}
     </ul>
 	<h3 id="label"></h3>
-    <div id="chart" style="width: 800; height: 600"></div>
+    <div id="chart" style="width: 800"></div>
   </body>
 </html>
 `
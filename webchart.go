@@ -0,0 +1,234 @@
+package main
+
+// webChartJS renders line charts as SVG without any external dependencies so
+// that the generated pages work offline. webChart.draw accepts the same data
+// layout as google.visualization.arrayToDataTable (a header row followed by a
+// row per x value) and the subset of the LineChart options used by roachperf:
+// per-series targetAxisIndex, color, lineDashStyle, lineWidth and pointSize,
+// vAxes titles and the hAxis title. If any x value is not a number the x axis
+// is categorical. Additionally, options.markers is a list of {x, label, color}
+// drawn as labeled vertical lines on numeric x axes.
+//
+// Note that the code is embedded in templates, so it must not contain template
+// delimiters or regular expression literals.
+const webChartJS = `
+var webChart = (function () {
+  var NS = "http://www.w3.org/2000/svg";
+
+  function el(name, attrs, parent) {
+    var e = document.createElementNS(NS, name);
+    for (var k in attrs) {
+      e.setAttribute(k, attrs[k]);
+    }
+    if (parent) {
+      parent.appendChild(e);
+    }
+    return e;
+  }
+
+  function text(parent, x, y, s, attrs) {
+    attrs = attrs || {};
+    attrs.x = x;
+    attrs.y = y;
+    attrs["font-family"] = "sans-serif";
+    attrs["font-size"] = attrs["font-size"] || 12;
+    var t = el("text", attrs, parent);
+    t.textContent = s;
+    return t;
+  }
+
+  function fmt(v) {
+    return String(+v.toFixed(6));
+  }
+
+  // ticks returns evenly spaced round values spanning [lo, hi].
+  function ticks(lo, hi, n) {
+    if (lo === hi) {
+      hi = lo + 1;
+    }
+    var step = Math.pow(10, Math.floor(Math.log((hi - lo) / n) / Math.LN10));
+    var f = (hi - lo) / n / step;
+    if (f >= 7.5) {
+      step *= 10;
+    } else if (f >= 3.5) {
+      step *= 5;
+    } else if (f >= 1.5) {
+      step *= 2;
+    }
+    var r = [];
+    var end = Math.ceil(hi / step - 1e-9) * step;
+    for (var v = Math.floor(lo / step + 1e-9) * step; v <= end + step / 2; v += step) {
+      r.push(v);
+    }
+    return r;
+  }
+
+  function scale(d0, d1, r0, r1) {
+    return function (v) {
+      return d1 === d0 ? r0 : r0 + (v - d0) * (r1 - r0) / (d1 - d0);
+    };
+  }
+
+  function draw(container, source, options) {
+    options = options || {};
+    var seriesOpts = options.series || {};
+    var vAxes = options.vAxes || {};
+    var header = source[0];
+    var rows = source.slice(1);
+    var width = container.clientWidth || 800;
+    var height = container.clientHeight || 600;
+
+    container.innerHTML = "";
+    var svg = el("svg", {width: width, height: height}, container);
+
+    var categorical = rows.some(function (row) { return typeof row[0] !== "number"; });
+    var series = [];
+    for (var c = 1; c < header.length; c++) {
+      var o = seriesOpts[c - 1] || {};
+      series.push({
+        column: c,
+        label: String(header[c]),
+        axis: o.targetAxisIndex || 0,
+        color: o.color || "#000000",
+        dash: (o.lineDashStyle || []).join(","),
+        lineWidth: o.lineWidth === undefined ? 2 : o.lineWidth,
+        pointSize: o.pointSize === undefined ? 6 : o.pointSize,
+      });
+    }
+
+    // Legend, wrapped to the width of the chart.
+    var lx = 10, ly = 20;
+    series.forEach(function (s) {
+      var w = 30 + 7 * s.label.length;
+      if (lx + w > width - 10 && lx > 10) {
+        lx = 10;
+        ly += 18;
+      }
+      el("line", {x1: lx, y1: ly - 4, x2: lx + 20, y2: ly - 4, stroke: s.color,
+        "stroke-width": 2, "stroke-dasharray": s.dash}, svg);
+      text(svg, lx + 24, ly, s.label);
+      lx += w;
+    });
+
+    var useRight = series.some(function (s) { return s.axis === 1; });
+    var left = 70, right = useRight ? width - 70 : width - 20;
+    var top = ly + 20, bottom = height - 50;
+
+    // The y axes start at zero unless there are negative values.
+    var axes = [0, 1].map(function (a) {
+      var lo = 0, hi = 0;
+      series.forEach(function (s) {
+        if (s.axis !== a) {
+          return;
+        }
+        rows.forEach(function (row) {
+          var v = row[s.column];
+          if (typeof v === "number") {
+            lo = Math.min(lo, v);
+            hi = Math.max(hi, v);
+          }
+        });
+      });
+      var t = ticks(lo, hi, 8);
+      return {ticks: t, y: scale(t[0], t[t.length - 1], bottom, top)};
+    });
+
+    var x, xticks;
+    if (categorical) {
+      var step = rows.length > 1 ? (right - left) / (rows.length - 1) : 0;
+      x = function (v, i) { return rows.length > 1 ? left + i * step : (left + right) / 2; };
+      var every = Math.max(1, Math.ceil(rows.length * 80 / (right - left)));
+      xticks = [];
+      rows.forEach(function (row, i) {
+        if (i % every === 0) {
+          xticks.push({x: x(row[0], i), label: String(row[0])});
+        }
+      });
+    } else {
+      var xlo = Infinity, xhi = -Infinity;
+      rows.forEach(function (row) {
+        xlo = Math.min(xlo, row[0]);
+        xhi = Math.max(xhi, row[0]);
+      });
+      if (!rows.length) {
+        xlo = 0;
+        xhi = 1;
+      }
+      var t = ticks(xlo, xhi, 10);
+      var xs = scale(t[0], t[t.length - 1], left, right);
+      x = function (v) { return xs(v); };
+      xticks = t.map(function (v) { return {x: xs(v), label: fmt(v)}; });
+    }
+
+    // Grid and axes.
+    axes[0].ticks.forEach(function (v) {
+      var y = axes[0].y(v);
+      el("line", {x1: left, y1: y, x2: right, y2: y, stroke: "#e0e0e0"}, svg);
+      text(svg, left - 6, y + 4, fmt(v), {"text-anchor": "end"});
+    });
+    if (useRight) {
+      axes[1].ticks.forEach(function (v) {
+        text(svg, right + 6, axes[1].y(v) + 4, fmt(v));
+      });
+    }
+    xticks.forEach(function (t) {
+      el("line", {x1: t.x, y1: bottom, x2: t.x, y2: bottom + 4, stroke: "#333333"}, svg);
+      text(svg, t.x, bottom + 18, t.label, {"text-anchor": "middle"});
+    });
+    el("line", {x1: left, y1: bottom, x2: right, y2: bottom, stroke: "#333333"}, svg);
+
+    if (options.hAxis && options.hAxis.title) {
+      text(svg, (left + right) / 2, height - 10, options.hAxis.title, {"text-anchor": "middle", "font-style": "italic"});
+    }
+    [0, 1].forEach(function (a) {
+      if (!vAxes[a] || !vAxes[a].title || (a === 1 && !useRight)) {
+        return;
+      }
+      var ax = a === 0 ? 16 : width - 8;
+      var ay = (top + bottom) / 2;
+      text(svg, ax, ay, vAxes[a].title, {"text-anchor": "middle", "font-style": "italic",
+        transform: "rotate(-90 " + ax + " " + ay + ")"});
+    });
+
+    if (!categorical) {
+      (options.markers || []).forEach(function (m) {
+        var px = x(m.x);
+        if (px < left || px > right) {
+          return;
+        }
+        var g = el("g", {}, svg);
+        el("line", {x1: px, y1: top, x2: px, y2: bottom, stroke: m.color || "#808080",
+          "stroke-dasharray": "4,4"}, g);
+        text(g, px + 3, top, m.label, {"font-size": 10, fill: m.color || "#808080",
+          transform: "rotate(90 " + (px + 3) + " " + top + ")"});
+        el("title", {}, g).textContent = m.label;
+      });
+    }
+
+    // Series. Missing values break the line.
+    series.forEach(function (s) {
+      var y = axes[s.axis].y;
+      var d = "", move = true;
+      var g = el("g", {}, svg);
+      rows.forEach(function (row, i) {
+        var v = row[s.column];
+        if (typeof v !== "number") {
+          move = true;
+          return;
+        }
+        var px = x(row[0], i), py = y(v);
+        d += (move ? "M" : "L") + px + " " + py + " ";
+        move = false;
+        var p = el("circle", {cx: px, cy: py, r: s.pointSize / 2, fill: s.color}, g);
+        el("title", {}, p).textContent = s.label + "\n" + header[0] + ": " + row[0] + "\n" + fmt(v);
+      });
+      if (s.lineWidth > 0) {
+        el("path", {d: d, fill: "none", stroke: s.color, "stroke-width": s.lineWidth,
+          "stroke-dasharray": s.dash}, g);
+      }
+    });
+  }
+
+  return {draw: draw};
+})();
+`
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// webRunName is the name of the run to display over time (e.g. 64 or kv_95).
+var webRunName string
+
+// webMarker is a labeled vertical line drawn on a chart.
+type webMarker struct {
+	X     float64 `json:"x"`
+	Label string  `json:"label"`
+	Color string  `json:"color"`
+}
+
+// webRun displays the throughput and latency of a run over time, along with
+// the events which occurred during the run. If multiple tests are specified,
+// the run of each test is overlaid.
+func webRun(w io.Writer, dirs []string, run string) error {
+	header := []interface{}{"elapsed (s)"}
+	var s []series
+	var markers []webMarker
+	rows := map[float64][]interface{}{}
+
+	for i, dir := range dirs {
+		dir = resolveTestDir(dir)
+		d, err := loadTestData(dir)
+		if err != nil {
+			return err
+		}
+		intervals, err := loadRunIntervals(dir, run)
+		if err != nil {
+			return err
+		}
+		if len(intervals) == 0 {
+			return fmt.Errorf("%s: no interval output for run %s", dir, run)
+		}
+		events, err := loadRunEvents(dir, run)
+		if err != nil {
+			return err
+		}
+
+		label := d.Metadata.Bin
+		if label == "" {
+			label = dir
+		}
+		color := webColors[i%len(webColors)]
+		header = append(header,
+			fmt.Sprintf("ops/sec (%s)", label),
+			fmt.Sprintf("p50 (%s)", label),
+			fmt.Sprintf("p99 (%s)", label),
+			fmt.Sprintf("pMax (%s)", label))
+		s = append(s,
+			series{0, color, []int{}},
+			series{1, color, []int{2, 2}},
+			series{1, color, []int{4, 4}},
+			series{1, color, []int{8, 4}})
+
+		for _, r := range intervals {
+			row := rows[r.Elapsed]
+			if row == nil {
+				row = make([]interface{}, 4*len(dirs))
+				rows[r.Elapsed] = row
+			}
+			copy(row[4*i:], []interface{}{r.OpsSec, r.P50Lat, r.P99Lat, r.PMaxLat})
+		}
+
+		if t := d.Metadata.measureStart(); t > 0 {
+			text := "measurement start"
+			if len(dirs) > 1 {
+				text = label + " " + text
+			}
+			markers = append(markers, webMarker{X: t, Label: text, Color: color})
+		}
+
+		// The interval output is relative to the start of the load.
+		var start int
+		for start < len(events) && events[start].Kind != loadEvent {
+			start++
+		}
+		if start == len(events) {
+			continue
+		}
+		for _, e := range events[start+1:] {
+			text := e.Kind
+			if e.Message != "" {
+				text += ": " + e.Message
+			}
+			if len(dirs) > 1 {
+				text = label + " " + text
+			}
+			markers = append(markers, webMarker{
+				X:     e.Time.Sub(events[start].Time).Seconds(),
+				Label: text,
+				Color: color,
+			})
+		}
+	}
+
+	var elapsed []float64
+	for e := range rows {
+		elapsed = append(elapsed, e)
+	}
+	sort.Float64s(elapsed)
+	data := []interface{}{header}
+	for _, e := range elapsed {
+		data = append(data, append([]interface{}{e}, rows[e]...))
+	}
+
+	m := map[string]interface{}{
+		"data":    data,
+		"haxis":   "elapsed (s)",
+		"vaxes":   []string{"ops/sec", "latency (ms)"},
+		"series":  s,
+		"markers": markers,
+	}
+	return webApply(w, m)
+}
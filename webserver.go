@@ -0,0 +1,373 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// webRunningWindow is how recently a test directory must have been modified
+// for the test to be considered in progress.
+const webRunningWindow = time.Minute
+
+// webRefresh is the interval at which pages displaying a test in progress are
+// refreshed.
+const webRefresh = 10 * time.Second
+
+// webEntry is a test listed by the results server.
+type webEntry struct {
+	// ID identifies the test in requests. It is either a result ID or a test
+	// directory.
+	ID       string
+	Name     string
+	Metadata testMetadata
+	Running  bool
+	// dir is the absolute path of the test directory.
+	dir string
+}
+
+// webEntries returns the tests in the specified directories or, if none are
+// specified, the registered results and the test directories in the current
+// directory.
+func webEntries(dirs []string) ([]webEntry, error) {
+	var entries []webEntry
+	seen := map[string]bool{}
+	add := func(id, dir string) error {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return err
+		}
+		if seen[abs] {
+			return nil
+		}
+		seen[abs] = true
+		e := webEntry{
+			ID:      id,
+			Name:    testDirName(abs),
+			Running: testInProgress(abs),
+			dir:     abs,
+		}
+		if err := loadJSON(filepath.Join(abs, "metadata"), &e.Metadata); err != nil {
+			return err
+		}
+		entries = append(entries, e)
+		return nil
+	}
+
+	if len(dirs) > 0 {
+		for _, dir := range dirs {
+			if err := add(dir, resolveTestDir(dir)); err != nil {
+				return nil, err
+			}
+		}
+		return entries, nil
+	}
+
+	results, err := loadResults()
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range results {
+		if _, err := os.Stat(r.Dir); err != nil {
+			continue
+		}
+		if err := add(r.ID, r.Dir); err != nil {
+			return nil, err
+		}
+	}
+	ents, err := ioutil.ReadDir(".")
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range ents {
+		if !e.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(e.Name(), "metadata")); err != nil {
+			continue
+		}
+		if err := add(e.Name(), e.Name()); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Metadata.Date < entries[j].Metadata.Date
+	})
+	return entries, nil
+}
+
+// testInProgress returns true if the test directory was recently modified.
+func testInProgress(dir string) bool {
+	ents, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	for _, e := range ents {
+		if time.Since(e.ModTime()) < webRunningWindow {
+			return true
+		}
+	}
+	return false
+}
+
+// webServe serves an index of the tests along with single test, comparison and
+// overview pages which are rendered on demand. Pages displaying a test in
+// progress are refreshed periodically.
+func webServe(addr string, dirs []string) error {
+	index, err := template.New("index").Parse(webHTMLIndex)
+	if err != nil {
+		return err
+	}
+	queue, err := template.New("queue").Parse(webHTMLQueue)
+	if err != nil {
+		return err
+	}
+
+	// lookup returns the entries for the requested IDs, or all of the entries
+	// if none are requested. Only listed tests may be requested.
+	lookup := func(ids []string) ([]webEntry, error) {
+		entries, err := webEntries(dirs)
+		if err != nil {
+			return nil, err
+		}
+		if len(ids) == 0 {
+			return entries, nil
+		}
+		byID := map[string]webEntry{}
+		for _, e := range entries {
+			byID[e.ID] = e
+		}
+		var selected []webEntry
+		for _, id := range ids {
+			e, ok := byID[id]
+			if !ok {
+				return nil, fmt.Errorf("unknown test: %s", id)
+			}
+			selected = append(selected, e)
+		}
+		return selected, nil
+	}
+
+	render := func(w http.ResponseWriter, r *http.Request, compare bool) {
+		entries, err := lookup(r.URL.Query()["dir"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if len(entries) == 0 {
+			http.Error(w, "no tests", http.StatusNotFound)
+			return
+		}
+		ids := make([]string, len(entries))
+		for i, e := range entries {
+			ids[i] = e.ID
+			if e.Running {
+				setRefresh(w)
+			}
+		}
+		// The baseline is either the 1-based index of a selected test or the ID
+		// of a test, which is added to the selection if necessary.
+		baseline := 1
+		if s := r.URL.Query().Get("baseline"); s != "" {
+			if baseline, err = strconv.Atoi(s); err != nil {
+				baseline = 0
+				for i, id := range ids {
+					if id == s {
+						baseline = i + 1
+					}
+				}
+				if baseline == 0 {
+					if _, err := lookup([]string{s}); err != nil {
+						http.Error(w, err.Error(), http.StatusNotFound)
+						return
+					}
+					ids = append(ids, s)
+					baseline = len(ids)
+				}
+			}
+		}
+		writePage(w, func(w io.Writer) error {
+			return webRender(w, ids, compare, baseline)
+		})
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		entries, err := webEntries(dirs)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, e := range entries {
+			if e.Running {
+				setRefresh(w)
+				break
+			}
+		}
+		writePage(w, func(w io.Writer) error {
+			return index.Execute(w, entries)
+		})
+	})
+	mux.HandleFunc("/view", func(w http.ResponseWriter, r *http.Request) {
+		render(w, r, true /* compare */)
+	})
+	mux.HandleFunc("/overview", func(w http.ResponseWriter, r *http.Request) {
+		render(w, r, false /* compare */)
+	})
+	mux.HandleFunc("/queue", func(w http.ResponseWriter, r *http.Request) {
+		jobs, err := loadQueue()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// Only the results of the served tests can be viewed.
+		entries, err := webEntries(dirs)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		served := map[string]string{}
+		for _, e := range entries {
+			served[e.dir] = e.ID
+		}
+		var rows []webQueueJob
+		for _, j := range jobs {
+			row := webQueueJob{queueJob: j, Test: strings.Join(j.Args, " "), Elapsed: j.elapsed()}
+			if dir := j.testDir(); dir != "" {
+				row.Result = served[dir]
+			}
+			if j.State == jobRunning {
+				setRefresh(w)
+			}
+			rows = append(rows, row)
+		}
+		writePage(w, func(w io.Writer) error {
+			return queue.Execute(w, rows)
+		})
+	})
+	mux.HandleFunc("/run", func(w http.ResponseWriter, r *http.Request) {
+		entries, err := lookup(r.URL.Query()["dir"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		run := r.URL.Query().Get("run")
+		if run == "" || len(r.URL.Query()["dir"]) == 0 {
+			http.Error(w, "no test or run specified", http.StatusBadRequest)
+			return
+		}
+		ids := make([]string, len(entries))
+		for i, e := range entries {
+			ids[i] = e.ID
+			if e.Running {
+				setRefresh(w)
+			}
+		}
+		writePage(w, func(w io.Writer) error {
+			return webRun(w, ids, run)
+		})
+	})
+
+	fmt.Printf("serving results on http://%s\n", addr)
+	return http.ListenAndServe(addr, mux)
+}
+
+// webQueueJob is a queued test listed on the queue page. Result is the ID of
+// the result of the test once it has started, if the result is served.
+type webQueueJob struct {
+	*queueJob
+	Test    string
+	Elapsed string
+	Result  string
+}
+
+// writePage renders a page to a buffer before writing it, so that an error
+// rendering the page isn't appended to a partially written page.
+func writePage(w http.ResponseWriter, render func(w io.Writer) error) {
+	var buf bytes.Buffer
+	if err := render(&buf); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_, _ = buf.WriteTo(w)
+}
+
+func setRefresh(w http.ResponseWriter) {
+	w.Header().Set("Refresh", strconv.Itoa(int(webRefresh.Seconds())))
+}
+
+const webHTMLIndex = `<html>
+  <head>
+    <title>roachperf</title>
+  </head>
+  <body>
+    <h2>performance review</h2>
+    <p><a href="/queue">test queue</a></p>
+    <p>View a single test by clicking its name. Compare tests by selecting them.
+    The tests are compared against the test chosen as the baseline, or the
+    selected test listed first if none is chosen. View a run of the selected
+    tests over time by entering its name.</p>
+    <form action="/view">
+      <table style="font-family: monospace; border-spacing: 12px 2px">
+        <tr><th></th><th>baseline</th><th>test</th><th>bin</th><th>cluster</th><th>date</th><th></th></tr>
+        {{- range . }}
+        <tr>
+          <td><input type="checkbox" name="dir" value="{{ .ID }}"></td>
+          <td><input type="radio" name="baseline" value="{{ .ID }}"></td>
+          <td><a href="/view?dir={{ .ID }}">{{ .Name }}</a></td>
+          <td>{{ .Metadata.Bin }}</td>
+          <td>{{ .Metadata.Cluster }}</td>
+          <td>{{ .Metadata.Date }}</td>
+          <td>{{ if .Running }}running{{ end }}</td>
+        </tr>
+        {{- end }}
+      </table>
+      <p>
+        <input type="submit" value="compare">
+        <input type="submit" value="overview" formaction="/overview">
+        <input type="text" name="run" placeholder="run (e.g. 64)" size="12">
+        <input type="submit" value="run over time" formaction="/run">
+      </p>
+    </form>
+  </body>
+</html>
+`
+
+const webHTMLQueue = `<html>
+  <head>
+    <title>roachperf queue</title>
+  </head>
+  <body>
+    <h2>test queue</h2>
+    <p><a href="/">results</a></p>
+    <table style="font-family: monospace; border-spacing: 12px 2px">
+      <tr><th>id</th><th>cluster</th><th>test</th><th>state</th><th>added</th><th>elapsed</th><th></th></tr>
+      {{- range . }}
+      <tr>
+        <td>{{ .ID }}</td>
+        <td>{{ .Cluster }}</td>
+        <td>{{ .Test }}</td>
+        <td>{{ .State }}{{ if .Error }}: {{ .Error }}{{ end }}</td>
+        <td>{{ .Added.Format "2006-01-02 15:04:05" }}</td>
+        <td>{{ .Elapsed }}</td>
+        <td>{{ if .Result }}<a href="/view?dir={{ .Result }}">results</a>{{ end }}</td>
+      </tr>
+      {{- end }}
+    </table>
+  </body>
+</html>
+`